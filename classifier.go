@@ -0,0 +1,217 @@
+package sequitur
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+// ClassifierMode selects how a Classifier scores a document against each class.
+type ClassifierMode int
+
+const (
+	// ByCompression scores a class by its compression gain: the number of grammar symbols saved
+	// by parsing the document after the training data of the class, rather than on its own.
+	// Probabilities are proportional to 2 to the power of the gain.
+	ByCompression ClassifierMode = iota
+	// BySimilarity scores a class by the similarity between the document and the training data of the class.
+	// Probabilities are proportional to the similarity.
+	BySimilarity
+)
+
+// Classifier assigns documents to the classes it was trained with, using a grammar of the training data of each class.
+// The grammar of each class is built as it is trained, and extended by each document scored against it then rolled
+// back, so a Classifier is not safe for concurrent use, even to score documents.
+type Classifier struct {
+	Mode       ClassifierMode
+	Metric     SimilarityMetric  // used by BySimilarity, or CoverageOverlap if nil
+	FilterKeep func([]byte) bool // filter applied when indexing for BySimilarity, see Compact.Index
+	labels     []string
+	classes    map[string]*classModel
+}
+
+// docSeparator separates documents parsed together, as a barrier, so that no rule spans two documents.
+// It is a noncharacter, so should not occur in the documents.
+const docSeparator = '\uFFFF'
+
+// classModel holds the grammar of the training data for a class, with what is derived from it built on demand.
+type classModel struct {
+	g     *Grammar        // each training document followed by docSeparator
+	size  int             // the Size of the grammar, or -1 if it has changed since it was measured
+	index *CompactIndexed // the grammar indexed for BySimilarity, or nil if it has changed since it was indexed
+}
+
+func newClassModel() *classModel {
+	return &classModel{g: NewGrammar(Options{Barriers: []rune{docSeparator}}), size: -1}
+}
+
+// train extends the grammar of the class with a document.
+func (cm *classModel) train(doc []byte) {
+	cm.g.Append(doc)
+	cm.g.Append([]byte(string(docSeparator)))
+	cm.size, cm.index = -1, nil
+}
+
+// gain gives the number of symbols the grammar of the class grows by when doc is appended to it,
+// leaving the grammar as it was.
+func (cm *classModel) gain(doc []byte) int {
+	if cm.size < 0 {
+		cm.size = cm.g.Compact().Size()
+	}
+	cp := cm.g.Checkpoint()
+	cm.g.Append(doc)
+	joint := cm.g.Compact().Size()
+	if err := cm.g.RollbackTo(cp); err != nil {
+		panic(err) // as nothing can have invalidated cp
+	}
+	return joint - cm.size
+}
+
+// indexed gives the grammar of the class indexed for BySimilarity.
+func (cm *classModel) indexed(filterKeep func([]byte) bool) *CompactIndexed {
+	if cm.index == nil {
+		cm.index = cm.g.Compact().Index(filterKeep)
+	}
+	return cm.index
+}
+
+// ClassScore is the score of a document against one class.
+type ClassScore struct {
+	Label       string
+	Score       float64
+	Probability float64
+}
+
+// NewClassifier returns an untrained Classifier.
+func NewClassifier(mode ClassifierMode) *Classifier {
+	return &Classifier{
+		Mode:    mode,
+		classes: make(map[string]*classModel),
+	}
+}
+
+// Train adds a labelled document to the training data.
+func (c *Classifier) Train(label string, doc []byte) {
+	if c.classes == nil {
+		c.classes = make(map[string]*classModel)
+	}
+	cm, exists := c.classes[label]
+	if !exists {
+		cm = newClassModel()
+		c.classes[label] = cm
+		c.labels = append(c.labels, label)
+		sort.Strings(c.labels)
+	}
+	cm.train(doc)
+}
+
+// Labels of the classes trained, in ascending order.
+func (c *Classifier) Labels() []string {
+	return c.labels
+}
+
+// Scores of a document against every class, ordered by descending probability.
+func (c *Classifier) Scores(doc []byte) []ClassScore {
+	if len(c.labels) == 0 {
+		return nil
+	}
+	ret := make([]ClassScore, len(c.labels))
+	switch c.Mode {
+	case BySimilarity:
+		ci := Parse(doc).Compact().Index(c.FilterKeep)
+		total := 0.0
+		for i, label := range c.labels {
+			ret[i] = ClassScore{Label: label, Score: ci.SimilarityWith(c.classes[label].indexed(c.FilterKeep), c.Metric)}
+			total += ret[i].Score
+		}
+		for i := range ret {
+			if total > 0 {
+				ret[i].Probability = ret[i].Score / total
+			} else {
+				ret[i].Probability = 1 / float64(len(ret))
+			}
+		}
+	default:
+		alone := float64(Parse(doc).Compact().Size())
+		best := math.Inf(-1)
+		for i, label := range c.labels {
+			ret[i] = ClassScore{Label: label, Score: alone - float64(c.classes[label].gain(doc))}
+			best = math.Max(best, ret[i].Score)
+		}
+		total := 0.0
+		for i := range ret {
+			ret[i].Probability = math.Exp2(ret[i].Score - best)
+			total += ret[i].Probability
+		}
+		for i := range ret {
+			ret[i].Probability /= total
+		}
+	}
+	sort.SliceStable(ret, func(i, j int) bool { return ret[i].Probability > ret[j].Probability })
+	return ret
+}
+
+// Classify a document, giving the most probable label and the probability of each label.
+func (c *Classifier) Classify(doc []byte) (label string, probabilities map[string]float64) {
+	scores := c.Scores(doc)
+	if len(scores) == 0 {
+		return "", nil
+	}
+	probabilities = make(map[string]float64, len(scores))
+	for _, s := range scores {
+		probabilities[s.Label] = s.Probability
+	}
+	return scores[0].Label, probabilities
+}
+
+// ConfusionMatrix counts the labels predicted by a Classifier for documents with known labels.
+type ConfusionMatrix struct {
+	Labels []string // the labels of the rows and columns, in ascending order
+	Counts [][]int  // Counts[actual][predicted], indexed as Labels
+}
+
+// Evaluate classifies each document, comparing the result with its known label.
+func (c *Classifier) Evaluate(docs [][]byte, labels []string) (*ConfusionMatrix, error) {
+	if len(docs) != len(labels) {
+		return nil, errors.New("sequitur: Evaluate needs one label per document")
+	}
+	if len(c.labels) == 0 {
+		return nil, errors.New("sequitur: Evaluate needs a trained Classifier")
+	}
+	index := make(map[string]int)
+	cm := &ConfusionMatrix{}
+	for _, label := range append(append([]string{}, c.labels...), labels...) {
+		if _, found := index[label]; !found {
+			index[label] = -1
+			cm.Labels = append(cm.Labels, label)
+		}
+	}
+	sort.Strings(cm.Labels)
+	cm.Counts = make([][]int, len(cm.Labels))
+	for i, label := range cm.Labels {
+		index[label] = i
+		cm.Counts[i] = make([]int, len(cm.Labels))
+	}
+	for d, doc := range docs {
+		predicted, _ := c.Classify(doc)
+		cm.Counts[index[labels[d]]][index[predicted]]++
+	}
+	return cm, nil
+}
+
+// Accuracy is the proportion of documents given their known label.
+func (cm *ConfusionMatrix) Accuracy() float64 {
+	correct, total := 0, 0
+	for i, row := range cm.Counts {
+		for j, n := range row {
+			if i == j {
+				correct += n
+			}
+			total += n
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(correct) / float64(total)
+}
@@ -0,0 +1,103 @@
+package sequitur
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+var testLanguages = map[string][]string{
+	"en": {
+		"The quick brown fox jumps over the lazy dog. ",
+		"It was the best of times, it was the worst of times, it was the age of wisdom. ",
+		"All happy families are alike; each unhappy family is unhappy in its own way. ",
+		"The grammar is built by replacing repeated pairs of symbols with new rules. ",
+	},
+	"de": {
+		"Der schnelle braune Fuchs springt über den faulen Hund. ",
+		"Es war die beste der Zeiten, es war die schlechteste der Zeiten. ",
+		"Alle glücklichen Familien gleichen einander, jede unglückliche Familie ist auf ihre eigene Weise unglücklich. ",
+		"Die Grammatik wird gebaut, indem wiederholte Paare von Symbolen durch neue Regeln ersetzt werden. ",
+	},
+	"es": {
+		"El rápido zorro marrón salta sobre el perro perezoso. ",
+		"Era el mejor de los tiempos, era el peor de los tiempos. ",
+		"Todas las familias felices se parecen; cada familia infeliz lo es a su manera. ",
+		"La gramática se construye reemplazando pares repetidos de símbolos por nuevas reglas. ",
+	},
+}
+
+func trainLanguages(mode ClassifierMode) *Classifier {
+	c := NewClassifier(mode)
+	for label, docs := range testLanguages {
+		for _, doc := range docs {
+			c.Train(label, []byte(doc))
+		}
+	}
+	return c
+}
+
+func ExampleClassifier() {
+
+	c := trainLanguages(ByCompression)
+
+	for _, s := range c.Scores([]byte("the rules of the grammar are the best of all")) {
+		fmt.Printf("%s %5.1f %7.5f\n", s.Label, s.Score, s.Probability)
+	}
+
+	// Output:
+	// en  19.0 0.99948
+	// de   8.0 0.00049
+	// es   4.0 0.00003
+}
+
+func TestClassifierEvaluate(t *testing.T) {
+	docs := [][]byte{
+		[]byte("it was the worst of the rules"),
+		[]byte("die Zeiten der Familien"),
+		[]byte("los tiempos de las familias"),
+		[]byte("each family is happy in its way"),
+	}
+	labels := []string{"en", "de", "es", "en"}
+	cm, err := trainLanguages(ByCompression).Evaluate(docs, labels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a := cm.Accuracy(); a != 1 {
+		t.Errorf("accuracy %v, confusion matrix %v %v", a, cm.Labels, cm.Counts)
+	}
+	label, probabilities := trainLanguages(BySimilarity).Classify([]byte("die Zeiten der Familien"))
+	if label != "de" {
+		t.Error("BySimilarity classified German as", label, probabilities)
+	}
+	if _, err := NewClassifier(ByCompression).Evaluate(docs, labels); err == nil {
+		t.Error("untrained Classifier evaluated")
+	}
+}
+
+func TestClassifierTrained(t *testing.T) {
+	c := trainLanguages(ByCompression)
+	doc := []byte("the rules of the grammar are the best of all")
+	want := make(map[string]string)
+	for label, cm := range c.classes {
+		want[label] = cm.g.Compact().String()
+	}
+	first := fmt.Sprint(c.Scores(doc))
+	if again := fmt.Sprint(c.Scores(doc)); again != first {
+		t.Errorf("scoring again gave %s, want %s", again, first)
+	}
+	for label, cm := range c.classes {
+		if got := cm.g.Compact().String(); got != want[label] {
+			t.Errorf("%s: scoring changed the grammar to\n%s\nwant\n%s", label, got, want[label])
+		}
+		if err := checkInvariants(cm.g); err != nil {
+			t.Errorf("%s: %v", label, err)
+		}
+		comp := cm.g.Compact()
+		for sid := range comp.Map {
+			if b := comp.Bytes(sid); sid != comp.RootID && bytes.ContainsRune(b, docSeparator) {
+				t.Errorf("%s: rule %q spans training documents", label, b)
+			}
+		}
+	}
+}
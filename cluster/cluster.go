@@ -0,0 +1,251 @@
+// Package cluster groups items by the similarities between them,
+// for example the matrix given by sequitur.SimilarityMatrix for a set of documents.
+//
+// Similarities are expected to be in the range 0 (nothing in common) to 1 (equality),
+// with sim[i][j] the similarity of item i to item j.
+package cluster
+
+import (
+	"errors"
+	"sort"
+)
+
+// ErrMatrix is returned when a similarity matrix is not square.
+var ErrMatrix = errors.New("cluster: similarity matrix is not square")
+
+// Linkage selects how the similarity between two clusters is derived from the similarities of their items.
+type Linkage int
+
+const (
+	SingleLinkage   Linkage = iota // the similarity of the most similar pair of items
+	CompleteLinkage                // the similarity of the least similar pair of items
+	AverageLinkage                 // the mean similarity of all pairs of items
+)
+
+// Node is a node of the dendrogram built by Agglomerative.
+type Node struct {
+	Left, Right *Node   // the clusters merged to form this one, both nil for a leaf
+	Item        int     // the item of a leaf, -1 otherwise
+	Similarity  float64 // the similarity between Left and Right when they were merged
+	Size        int     // the number of items in the cluster
+}
+
+// IsLeaf says if the Node represents a single item.
+func (n *Node) IsLeaf() bool {
+	return n.Left == nil && n.Right == nil
+}
+
+// Items in the cluster, in ascending order.
+func (n *Node) Items() []int {
+	if n == nil {
+		return nil
+	}
+	ret := make([]int, 0, n.Size)
+	var walk func(n *Node)
+	walk = func(n *Node) {
+		if n.IsLeaf() {
+			ret = append(ret, n.Item)
+			return
+		}
+		walk(n.Left)
+		walk(n.Right)
+	}
+	walk(n)
+	sort.Ints(ret)
+	return ret
+}
+
+// Cut the dendrogram into flat clusters, keeping together the items merged at a similarity of at least threshold.
+// The clusters are ordered by their first item.
+func (n *Node) Cut(threshold float64) [][]int {
+	if n == nil {
+		return nil
+	}
+	ret := [][]int{}
+	var walk func(n *Node)
+	walk = func(n *Node) {
+		if n.IsLeaf() || n.Similarity >= threshold {
+			ret = append(ret, n.Items())
+			return
+		}
+		walk(n.Left)
+		walk(n.Right)
+	}
+	walk(n)
+	sort.Slice(ret, func(i, j int) bool { return ret[i][0] < ret[j][0] })
+	return ret
+}
+
+// Agglomerative performs hierarchical clustering, repeatedly merging the two most similar clusters,
+// and returns the root of the resulting dendrogram, or nil if there are no items.
+// The similarity of sim[i][j] and sim[j][i] is averaged, as some similarity metrics are asymmetric.
+func Agglomerative(sim [][]float64, linkage Linkage) (*Node, error) {
+	if err := checkSquare(sim); err != nil {
+		return nil, err
+	}
+	n := len(sim)
+	if n == 0 {
+		return nil, nil
+	}
+	nodes := make([]*Node, n)
+	cs := make([][]float64, n)
+	for i := range sim {
+		nodes[i] = &Node{Item: i, Size: 1}
+		cs[i] = make([]float64, n)
+		for j := range sim {
+			cs[i][j] = (sim[i][j] + sim[j][i]) / 2
+		}
+	}
+	active := make([]int, n)
+	for i := range active {
+		active[i] = i
+	}
+	for len(active) > 1 {
+		bi, bj := 0, 1
+		for x := 0; x < len(active); x++ {
+			for y := x + 1; y < len(active); y++ {
+				if cs[active[x]][active[y]] > cs[active[bi]][active[bj]] {
+					bi, bj = x, y
+				}
+			}
+		}
+		i, j := active[bi], active[bj]
+		ni, nj := float64(nodes[i].Size), float64(nodes[j].Size)
+		for _, k := range active {
+			if k == i || k == j {
+				continue
+			}
+			var s float64
+			switch linkage {
+			case SingleLinkage:
+				s = maxf(cs[i][k], cs[j][k])
+			case CompleteLinkage:
+				s = minf(cs[i][k], cs[j][k])
+			default:
+				s = (ni*cs[i][k] + nj*cs[j][k]) / (ni + nj)
+			}
+			cs[i][k], cs[k][i] = s, s
+		}
+		nodes[i] = &Node{
+			Left:       nodes[i],
+			Right:      nodes[j],
+			Item:       -1,
+			Similarity: cs[i][j],
+			Size:       nodes[i].Size + nodes[j].Size,
+		}
+		active = append(active[:bj], active[bj+1:]...)
+	}
+	return nodes[active[0]], nil
+}
+
+// KMedoids partitions the items into k clusters, each represented by its medoid:
+// the item with the greatest total similarity to the other items of the cluster.
+// It returns the medoids and, in the same order, the items of their clusters.
+func KMedoids(sim [][]float64, k int) (medoids []int, clusters [][]int, err error) {
+	if err := checkSquare(sim); err != nil {
+		return nil, nil, err
+	}
+	n := len(sim)
+	if k < 1 || k > n {
+		return nil, nil, errors.New("cluster: k out of range")
+	}
+
+	// greedy initialisation, each new medoid adding the most to the similarity of items to their medoid
+	best := make([]float64, n)
+	for i := range best {
+		best[i] = -1
+	}
+	isMedoid := make([]bool, n)
+	for len(medoids) < k {
+		pick, pickGain := -1, 0.0
+		for c := 0; c < n; c++ {
+			if isMedoid[c] {
+				continue
+			}
+			gain := 0.0
+			for i := 0; i < n; i++ {
+				if s := sim[i][c]; s > best[i] {
+					gain += s - best[i]
+				}
+			}
+			if pick == -1 || gain > pickGain {
+				pick, pickGain = c, gain
+			}
+		}
+		medoids = append(medoids, pick)
+		isMedoid[pick] = true
+		for i := 0; i < n; i++ {
+			best[i] = maxf(best[i], sim[i][pick])
+		}
+	}
+
+	for iter := 0; iter < 100; iter++ {
+		clusters = assign(sim, medoids)
+		changed := false
+		for m, members := range clusters {
+			medoid, total := medoids[m], 0.0
+			for _, i := range members {
+				total += sim[i][medoid]
+			}
+			for _, c := range members {
+				t := 0.0
+				for _, i := range members {
+					t += sim[i][c]
+				}
+				if t > total {
+					medoid, total = c, t
+				}
+			}
+			if medoid != medoids[m] {
+				medoids[m] = medoid
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+	return medoids, assign(sim, medoids), nil
+}
+
+// assign each item to its most similar medoid.
+func assign(sim [][]float64, medoids []int) [][]int {
+	clusters := make([][]int, len(medoids))
+	for i := range sim {
+		m := 0
+		for x, medoid := range medoids {
+			if medoid == i {
+				m = x
+				break
+			}
+			if sim[i][medoid] > sim[i][medoids[m]] {
+				m = x
+			}
+		}
+		clusters[m] = append(clusters[m], i)
+	}
+	return clusters
+}
+
+func checkSquare(sim [][]float64) error {
+	for _, row := range sim {
+		if len(row) != len(sim) {
+			return ErrMatrix
+		}
+	}
+	return nil
+}
+
+func maxf(a, b float64) float64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func minf(a, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
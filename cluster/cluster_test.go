@@ -0,0 +1,87 @@
+package cluster
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// two groups of similar items, {0, 2, 4} and {1, 3}
+var testSim = [][]float64{
+	{1.0, 0.1, 0.8, 0.0, 0.6},
+	{0.1, 1.0, 0.2, 0.9, 0.1},
+	{0.8, 0.2, 1.0, 0.1, 0.7},
+	{0.0, 0.9, 0.1, 1.0, 0.2},
+	{0.6, 0.1, 0.7, 0.2, 1.0},
+}
+
+func ExampleAgglomerative() {
+
+	root, err := Agglomerative(testSim, AverageLinkage)
+	if err != nil {
+		panic(err)
+	}
+
+	var show func(n *Node, indent string)
+	show = func(n *Node, indent string) {
+		if n.IsLeaf() {
+			fmt.Println(indent, n.Item)
+			return
+		}
+		fmt.Printf("%s %.2f\n", indent, n.Similarity)
+		show(n.Left, indent+"  ")
+		show(n.Right, indent+"  ")
+	}
+	show(root, "")
+
+	fmt.Println(root.Cut(0.5))
+
+	// Output:
+	//  0.12
+	//    0.65
+	//      0.80
+	//        0
+	//        2
+	//      4
+	//    0.90
+	//      1
+	//      3
+	// [[0 2 4] [1 3]]
+}
+
+func TestAgglomerativeLinkage(t *testing.T) {
+	for _, linkage := range []Linkage{SingleLinkage, CompleteLinkage, AverageLinkage} {
+		root, err := Agglomerative(testSim, linkage)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if root.Size != len(testSim) {
+			t.Error(linkage, "root size", root.Size)
+		}
+		if got, want := root.Cut(0.5), [][]int{{0, 2, 4}, {1, 3}}; !reflect.DeepEqual(got, want) {
+			t.Error(linkage, "Cut(0.5) gave", got, "want", want)
+		}
+		if got := root.Cut(1.1); len(got) != len(testSim) {
+			t.Error(linkage, "Cut(1.1) gave", got)
+		}
+	}
+}
+
+func TestKMedoids(t *testing.T) {
+	medoids, clusters, err := KMedoids(testSim, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{2, 1}; !reflect.DeepEqual(medoids, want) {
+		t.Error("medoids", medoids, "want", want)
+	}
+	if want := [][]int{{0, 2, 4}, {1, 3}}; !reflect.DeepEqual(clusters, want) {
+		t.Error("clusters", clusters, "want", want)
+	}
+	if _, _, err := KMedoids(testSim, 6); err == nil {
+		t.Error("k larger than the number of items accepted")
+	}
+	if _, _, err := KMedoids([][]float64{{1, 0}}, 1); err != ErrMatrix {
+		t.Error("non-square matrix accepted:", err)
+	}
+}
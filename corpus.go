@@ -0,0 +1,137 @@
+package sequitur
+
+import (
+	"bytes"
+	"sort"
+)
+
+// Corpus indexes many documents, with an inverted index from the []byte represented by each symbol
+// (the keys of CompactIndexed.StringToID) to the documents which contain it. The zero value is an empty Corpus.
+type Corpus struct {
+	FilterKeep func([]byte) bool // filter applied to the symbols of documents added by Add, see Compact.Index
+	Docs       []*CompactIndexed
+	postings   map[string][]Posting
+}
+
+// Posting records a symbol found in one document of a Corpus.
+type Posting struct {
+	Doc   int      // the index of the document in Corpus.Docs
+	ID    SymbolID // the SymbolID in that document
+	Count int      // the number of times the []byte of the symbol occurs as a symbol in that document
+}
+
+// PhraseFrequency gives the corpus-wide frequency of a phrase.
+type PhraseFrequency struct {
+	Phrase []byte
+	Docs   int // the number of documents containing the phrase
+	Count  int // the total number of times the phrase occurs in all documents
+}
+
+// Match is a document found by Corpus.Similar.
+type Match struct {
+	Doc   int // the index of the document in Corpus.Docs
+	Score float64
+}
+
+// NewCorpus returns an empty Corpus, optionally filtering the symbols of the documents it indexes.
+func NewCorpus(filterKeep func([]byte) bool) *Corpus {
+	return &Corpus{
+		FilterKeep: filterKeep,
+		postings:   make(map[string][]Posting),
+	}
+}
+
+// Add parses and indexes a document, returning its index in Docs.
+func (c *Corpus) Add(doc []byte) int {
+	return c.AddIndexed(Parse(doc).Compact().Index(c.FilterKeep))
+}
+
+// AddIndexed adds an already indexed document, returning its index in Docs.
+func (c *Corpus) AddIndexed(ci *CompactIndexed) int {
+	if c.postings == nil {
+		c.postings = make(map[string][]Posting)
+	}
+	doc := len(c.Docs)
+	c.Docs = append(c.Docs, ci)
+	if ci == nil {
+		return doc
+	}
+	counts, hashes := ci.hashCounts(), ci.symbolHashes()
+	for str, sid := range ci.StringToID {
+		c.postings[str] = append(c.postings[str], Posting{
+			Doc:   doc,
+			ID:    sid,
+			Count: counts[hashes[sid]],
+		})
+	}
+	return doc
+}
+
+// Containing lists the documents which contain the phrase as a symbol, in the order they were added.
+func (c *Corpus) Containing(phrase []byte) []Posting {
+	return c.postings[string(phrase)]
+}
+
+// Frequency gives the corpus-wide frequency of a phrase which is a symbol in at least one document.
+func (c *Corpus) Frequency(phrase []byte) PhraseFrequency {
+	ret := PhraseFrequency{Phrase: phrase}
+	for _, p := range c.postings[string(phrase)] {
+		ret.Docs++
+		ret.Count += p.Count
+	}
+	return ret
+}
+
+// Phrases ranks the phrases of the corpus by the number of documents they occur in, then their total count.
+// At most k are returned, or all of them if k <= 0.
+func (c *Corpus) Phrases(k int) []PhraseFrequency {
+	ret := make([]PhraseFrequency, 0, len(c.postings))
+	for str := range c.postings {
+		ret = append(ret, c.Frequency([]byte(str)))
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Docs != ret[j].Docs {
+			return ret[i].Docs > ret[j].Docs
+		}
+		if ret[i].Count != ret[j].Count {
+			return ret[i].Count > ret[j].Count
+		}
+		return bytes.Compare(ret[i].Phrase, ret[j].Phrase) < 0 // arbitrary but stable order
+	})
+	if k > 0 && k < len(ret) {
+		ret = ret[:k]
+	}
+	return ret
+}
+
+// Similar finds the k documents most similar to the query, scored as by CompactIndexed.Similarity,
+// or all of the documents with any symbol in common if k <= 0.
+// Only the documents sharing a symbol with the query are visited.
+func (c *Corpus) Similar(query *CompactIndexed, k int) []Match {
+	if query == nil {
+		return nil
+	}
+	cumCoverage := make(map[int]float64)
+	for str, sid := range query.StringToID {
+		for _, p := range c.postings[str] {
+			cumCoverage[p.Doc] += query.IDinfo[sid].Coverage + c.Docs[p.Doc].IDinfo[p.ID].Coverage
+		}
+	}
+	ret := make([]Match, 0, len(cumCoverage))
+	for doc, cum := range cumCoverage {
+		ret = append(ret, Match{
+			Doc:   doc,
+			Score: cum / (query.TotalCoverage + c.Docs[doc].TotalCoverage),
+		})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Score == ret[j].Score {
+			return ret[i].Doc < ret[j].Doc // arbitrary but stable order
+		}
+		return ret[i].Score > ret[j].Score
+	})
+	if k > 0 && k < len(ret) {
+		ret = ret[:k]
+	}
+	return ret
+}
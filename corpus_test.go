@@ -0,0 +1,53 @@
+package sequitur
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func ExampleCorpus() {
+
+	texts := []string{testSimilarity, testImportance, testString, testCompact}
+
+	corpus := NewCorpus(func(b []byte) bool { return len(b) >= 4 })
+	for _, text := range texts {
+		corpus.Add([]byte(text))
+	}
+
+	for _, p := range corpus.Containing([]byte("the ")) {
+		fmt.Println("document", p.Doc, "contains \"the \"", p.Count, "times")
+	}
+	for _, pf := range corpus.Phrases(3) {
+		fmt.Printf("%q %d %d\n", pf.Phrase, pf.Docs, pf.Count)
+	}
+	for _, m := range corpus.Similar(corpus.Docs[0], 0) {
+		fmt.Printf("%d %7.5f\n", m.Doc, m.Score)
+	}
+
+	// Output:
+	// document 1 contains "the " 15 times
+	// "ition" 2 8
+	// " the " 1 25
+	// "gram" 1 24
+	// 0 1.00000
+	// 1 0.00534
+}
+
+func TestCorpusSimilar(t *testing.T) {
+	texts := []string{testSimilarity, testImportance, testString, testCompact, ""}
+	var corpus Corpus
+	for _, text := range texts {
+		corpus.Add([]byte(text))
+	}
+	for _, query := range corpus.Docs {
+		for _, m := range corpus.Similar(query, 0) {
+			if want := query.Similarity(corpus.Docs[m.Doc]); math.Abs(m.Score-want) > 1e-9 {
+				t.Errorf("document %d scored %v, Similarity gives %v", m.Doc, m.Score, want)
+			}
+		}
+	}
+	if got := corpus.Similar(corpus.Docs[1], 1); len(got) != 1 || got[0].Doc != 1 {
+		t.Error("document is not most similar to itself:", got)
+	}
+}
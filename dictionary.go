@@ -0,0 +1,160 @@
+package sequitur
+
+import "sort"
+
+// ParseWithDictionary parses the given bytes using the rules of an existing grammar, such as one built from
+// a corpus of similar documents, as a dictionary. Wherever the input contains the expansion of a rule of the
+// dictionary, the longest first, it is represented by that rule, with its SymbolID from the dictionary,
+// even at its first occurrence. Rules from the dictionary are kept while they are used at all, so short inputs
+// which repeat little of themselves still share rules with the dictionary, and with other inputs parsed
+// with it, making them comparable and compressible. Rules from the dictionary are only added to the grammar
+// when they are used, and new rules are numbered after the largest SymbolID in the dictionary.
+// The dictionary only applies to the given bytes: input added later by Append is parsed as by Parse, so it uses
+// the rules from the dictionary which the grammar already has where it repeats them, but no others.
+func ParseWithDictionary(str []byte, base *Compact) *Grammar {
+	g := newGrammar()
+	if base == nil || base.RootID == EmptySymbolID {
+		g.appendBytes(str)
+		return g
+	}
+	g.trackUses() // as rules from the dictionary may be used once
+	d := newDictionary(g, base)
+
+	var seq SymbolIDslice
+	eachRuneOrByte(str, func(rb runeOrByte) {
+		seq = append(seq, SymbolID(rb))
+	})
+	for i := 0; i < len(seq); {
+		sid, n := d.longestMatch(seq[i:])
+		if n == 0 {
+			g.appendValue(uint64(seq[i]))
+			i++
+			continue
+		}
+		g.appendSymbol(g.newSymbolFromRule(d.rule(sid)))
+		g.length += n
+		g.appended += n
+		i += n
+	}
+	return g
+}
+
+// dictionary finds the rules of a Compact grammar in the input, and adds them to the Grammar when they are used.
+type dictionary struct {
+	g     *Grammar
+	comp  *Compact
+	rules map[SymbolID]*rules // the rules added to the grammar so far
+	trie  map[trieEdge]int    // the child of each node of a trie of the expansions of the rules, the root being 0
+	ends  map[int]SymbolID    // the rule whose expansion ends at each node
+}
+
+// trieEdge is an edge from a node of the trie of a dictionary, labelled with a terminal symbol.
+type trieEdge struct {
+	node int
+	sid  SymbolID
+}
+
+func newDictionary(g *Grammar, comp *Compact) *dictionary {
+	d := &dictionary{
+		g:     g,
+		comp:  comp,
+		rules: make(map[SymbolID]*rules),
+		trie:  make(map[trieEdge]int),
+		ends:  make(map[int]SymbolID),
+	}
+	// the rules are added in order, so where two have the same expansion the first is used
+	order := make(SymbolIDslice, 0, len(comp.Map))
+	for sid := range comp.Map {
+		if sid != comp.RootID && len(comp.Map[sid].IDs) >= 2 {
+			order = append(order, sid)
+		}
+		if uint64(sid) > g.ruleID {
+			g.ruleID = uint64(sid)
+		}
+	}
+	sort.Slice(order, func(i, j int) bool { return order[i] < order[j] })
+	if _, taken := comp.Map[SymbolID(rootRuleID)]; taken && comp.RootID != SymbolID(rootRuleID) {
+		g.base = g.newRules() // renumbered after the dictionary, as its rule would otherwise share the root's ID
+	}
+	expansions := make(map[SymbolID]SymbolIDslice)
+	for _, sid := range order {
+		node := 0
+		for _, t := range d.expansion(sid, expansions) {
+			next, found := d.trie[trieEdge{node, t}]
+			if !found {
+				next = len(d.trie) + 1
+				d.trie[trieEdge{node, t}] = next
+			}
+			node = next
+		}
+		if _, found := d.ends[node]; !found && node != 0 {
+			d.ends[node] = sid
+		}
+	}
+	return d
+}
+
+// expansion gives the terminal symbols of a rule of the dictionary.
+func (d *dictionary) expansion(sid SymbolID, expansions map[SymbolID]SymbolIDslice) SymbolIDslice {
+	if ret, done := expansions[sid]; done {
+		return ret
+	}
+	var ret SymbolIDslice
+	for _, child := range d.comp.Map[sid].IDs {
+		if child.IsRule() {
+			ret = append(ret, d.expansion(child, expansions)...)
+		} else {
+			ret = append(ret, child)
+		}
+	}
+	expansions[sid] = ret
+	return ret
+}
+
+// longestMatch finds the rule of the dictionary with the longest expansion at the start of seq,
+// giving the length of its expansion, or 0 if there is none.
+func (d *dictionary) longestMatch(seq SymbolIDslice) (SymbolID, int) {
+	best, length := SymbolID(EmptySymbolID), 0
+	node := 0
+	for i, t := range seq {
+		next, found := d.trie[trieEdge{node, t}]
+		if !found {
+			break
+		}
+		node = next
+		if sid, found := d.ends[node]; found {
+			best, length = sid, i+1
+		}
+	}
+	return best, length
+}
+
+// rule gives the rule of the grammar for a rule of the dictionary, adding it, and the rules it uses,
+// and checking its digrams, the first time it is used.
+func (d *dictionary) rule(sid SymbolID) *rules {
+	if r, done := d.rules[sid]; done && r.guard.next != r.guard {
+		return r
+	}
+	r := &rules{id: uint64(sid), dictionary: true}
+	r.guard = d.g.newGuard(r)
+	d.rules[sid] = r
+	var body []*symbols
+	for _, child := range d.comp.Map[sid].IDs {
+		for child.IsRule() && len(d.comp.Map[child].IDs) == 1 { // used in place of the rule
+			child = d.comp.Map[child].IDs[0]
+		}
+		if child.IsRule() {
+			r.last().insertAfter(d.g.newSymbolFromRule(d.rule(child)))
+		} else {
+			r.last().insertAfter(d.g.newSymbolFromValue(uint64(child)))
+		}
+		body = append(body, r.last())
+	}
+	for _, s := range body {
+		if s.inUse() {
+			s.check()
+			d.g.checkPending()
+		}
+	}
+	return r
+}
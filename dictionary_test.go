@@ -0,0 +1,110 @@
+package sequitur
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func ExampleParseWithDictionary() {
+
+	base := Parse([]byte(testSimilarity)).Compact()
+	doc := []byte("Sequitur forms rules from repetition in strings.")
+	doc2 := []byte("The rules of a grammar factor out repetition.")
+
+	alone := Parse(doc).Compact().Index(nil)
+	alone2 := Parse(doc2).Compact().Index(nil)
+	fmt.Printf("%.2f\n", alone.Similarity(alone2))
+
+	seeded := ParseWithDictionary(doc, base).Compact().Index(nil)
+	seeded2 := ParseWithDictionary(doc2, base).Compact().Index(nil)
+	fmt.Printf("%.2f\n", seeded.Similarity(seeded2))
+
+	// Output:
+	// 0.00
+	// 0.24
+}
+
+func TestParseWithDictionary(t *testing.T) {
+	check := func(in []byte, base *Compact) *Compact {
+		g := ParseWithDictionary(in, base)
+		if err := checkInvariants(g); err != nil {
+			t.Fatalf("%q: %v", in, err)
+		}
+		var b bytes.Buffer
+		if err := g.Print(&b); err != nil || b.String() != string(in) || g.Len() != len([]rune(string(in))) {
+			t.Fatalf("%q: got %q", in, b.Bytes())
+		}
+		comp := g.Compact()
+		for sid := range comp.Map {
+			if _, found := base.Map[sid]; found && sid != comp.RootID && !bytes.Equal(comp.Bytes(sid), base.Bytes(sid)) {
+				t.Fatalf("%q: rule %d is %q, not %q as in the dictionary", in, sid, comp.Bytes(sid), base.Bytes(sid))
+			}
+		}
+		return comp
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 300; i++ {
+		in := randomInput(rnd, i, 600, "abcd")
+		split := rnd.Intn(len(in) + 1)
+		var base *Compact
+		switch i % 3 {
+		case 0:
+			base = Parse(in[:split]).Compact()
+		case 1:
+			base = RePair(in[:split])
+		default:
+			base, _ = MergeCompact(Parse(in[:split/2]).Compact(), Parse(in[split/2:split]).Compact())
+		}
+		check(in[split:], base)
+		check(in, base)
+	}
+
+	files, ins := testFiles(t)
+	var corpus []byte
+	for _, in := range ins {
+		corpus = append(corpus, in...)
+	}
+	base := Parse(corpus).Compact()
+	for f, in := range ins {
+		n := len(in)
+		if n > 200 {
+			n = 200
+		}
+		doc := in[len(in)-n:]
+		alone := Parse(doc).Compact().Index(nil)
+		seeded := check(doc, base).Index(nil)
+		if alone.Similarity(base.Index(nil)) > seeded.Similarity(base.Index(nil))+1e-9 {
+			t.Errorf("%s: the dictionary made the end of the file less similar to the corpus", files[f])
+		}
+	}
+	if comp := ParseWithDictionary([]byte(testCompact), nil).Compact(); comp.String() != Parse([]byte(testCompact)).Compact().String() {
+		t.Errorf("no dictionary gave %v", comp)
+	}
+
+	// input appended later is not matched against the dictionary, but repeats the rules taken from it
+	doc := []byte("Sequitur forms rules from repetition in strings.")
+	base = Parse([]byte(testSimilarity)).Compact()
+	g := ParseWithDictionary(doc, base)
+	g.Append(doc)
+	if err := checkInvariants(g); err != nil {
+		t.Fatal(err)
+	}
+	comp := g.Compact()
+	taken := make(map[string]SymbolID)
+	for sid := range comp.Map {
+		if _, found := base.Map[sid]; found {
+			taken[string(comp.Bytes(sid))] = sid
+		}
+	}
+	if len(taken) == 0 {
+		t.Fatal("no rules taken from the dictionary")
+	}
+	for sid := range comp.Map {
+		if dict, found := taken[string(comp.Bytes(sid))]; found && dict != sid {
+			t.Errorf("rule %d repeats rule %d from the dictionary", sid, dict)
+		}
+	}
+}
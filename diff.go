@@ -0,0 +1,513 @@
+package sequitur
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// DiffOp is the kind of a DiffHunk.
+type DiffOp int
+
+const (
+	DiffEqual  DiffOp = iota // bytes present in both a and b
+	DiffDelete               // bytes only present in a
+	DiffInsert               // bytes only present in b
+)
+
+// String for DiffOp, as the prefix used by unified diffs.
+func (op DiffOp) String() string {
+	switch op {
+	case DiffDelete:
+		return "-"
+	case DiffInsert:
+		return "+"
+	}
+	return " "
+}
+
+// DiffHunk is one step of an edit script turning a into b.
+type DiffHunk struct {
+	Op      DiffOp
+	AOffset int // the offset in a of the hunk, or where it is inserted for DiffInsert
+	BOffset int // the offset in b of the hunk, or where it was deleted for DiffDelete
+	Length  int // the number of bytes in the hunk
+}
+
+// Diff gives an edit script turning a into b, aligned to the rules of a grammar of both. They are parsed as one
+// grammar, so that text shared by a and b is represented by the same rules, and the runes or bytes are compared with
+// the linear space form of the O((N+M)D) algorithm of Eugene Myers, which skips over the whole expansion of a rule
+// wherever the same rule begins, or ends, at the runes or bytes being compared in a and b. Each change is then
+// widened until it begins and ends at boundaries between the rules shared by a and b, in both a and b, so that
+// the text which is equal between changes is made of whole rules, or of runes or bytes which are in no shared rule.
+// The changes are therefore larger than those of a Myers diff, by about the length of the rules around them.
+// The time taken grows with the number of edits between a and b, and with the number of symbols compared between
+// them. Adjacent hunks never have the same Op.
+func Diff(a, b []byte) []DiffHunk {
+	d := diff(a, b)
+	if d.comp.RootID != EmptySymbolID {
+		d.align(alignBlocks(changeBlocks(d.hunks), len(a), len(b), func(i, j int) bool { return d.atA[i] && d.atB[j] }))
+	}
+	return d.hunks
+}
+
+// diff gives the hunks of a Myers diff turning a into b, before they are aligned, with the boundaries of the rules.
+func diff(a, b []byte) *differ {
+	g := newGrammar()
+	g.appendBytes(a)
+	g.appendBytes(b) // appended separately, so that no rune spans a and b
+	comp := g.Compact()
+	d := &differ{comp: comp, lengths: comp.lengths(), counts: make(map[SymbolID]int)}
+	if comp.RootID != EmptySymbolID {
+		x, y := d.split(comp.Map[comp.RootID].IDs, len(a))
+		d.x, d.y = d.sequence(x), d.sequence(y)
+		d.compare(0, len(d.x.ids), 0, len(d.y.ids))
+		inA, inB := d.rules(x), d.rules(y)
+		d.atA, d.atB = d.boundaries(x, inB), d.boundaries(y, inA)
+	}
+	return d
+}
+
+type differ struct {
+	comp       *Compact
+	lengths    map[SymbolID]int // the length in bytes of the expansion of each symbol
+	counts     map[SymbolID]int // the number of runes or bytes in the expansion of each symbol
+	x, y       sequence
+	atA, atB   map[int]bool // the offsets in a and b at the boundaries of the rules they share
+	aPos, bPos int
+	hunks      []DiffHunk
+}
+
+// sequence holds the runes or bytes of a or b, with the longest rules which begin and end at each of them.
+type sequence struct {
+	ids     SymbolIDslice // the runes or bytes
+	offsets []int         // the offset in bytes of each rune or byte, and of the end
+	starts  SymbolIDslice // the longest rule beginning at each rune or byte, or the rune or byte itself
+	ends    SymbolIDslice // the longest rule ending at each rune or byte, or the rune or byte itself
+}
+
+// split the symbols at the given byte offset, expanding any symbol which spans it.
+func (d *differ) split(ids SymbolIDslice, offset int) (left, right SymbolIDslice) {
+	for i, sid := range ids {
+		l := d.lengths[sid]
+		switch {
+		case l <= offset:
+			left = append(left, sid)
+			offset -= l
+		case offset == 0:
+			return left, append(right, ids[i:]...)
+		default:
+			subLeft, subRight := d.split(d.comp.Map[sid].IDs, offset)
+			left = append(left, subLeft...)
+			return left, append(append(right, subRight...), ids[i+1:]...)
+		}
+	}
+	return left, right
+}
+
+func (d *differ) sequence(ids SymbolIDslice) sequence {
+	s := sequence{offsets: []int{0}}
+	d.expand(&s, ids)
+	return s
+}
+
+// expand appends the runes or bytes of the symbols to the sequence, recording the rules which begin and end at them.
+func (d *differ) expand(s *sequence, ids SymbolIDslice) {
+	for _, sid := range ids {
+		first := len(s.ids)
+		if sid.IsRule() {
+			d.expand(s, d.comp.Map[sid].IDs)
+		} else {
+			s.ids = append(s.ids, sid)
+			s.offsets = append(s.offsets, s.offsets[len(s.offsets)-1]+d.lengths[sid])
+			s.starts = append(s.starts, sid)
+			s.ends = append(s.ends, sid)
+		}
+		// after the symbols the rule contains, so that the longest rule is recorded
+		s.starts[first] = sid
+		s.ends[len(s.ids)-1] = sid
+		d.counts[sid] = len(s.ids) - first
+	}
+}
+
+// rules gives the rules which the symbols contain, at any depth.
+func (d *differ) rules(ids SymbolIDslice) map[SymbolID]bool {
+	ret := make(map[SymbolID]bool)
+	var visit func(ids SymbolIDslice)
+	visit = func(ids SymbolIDslice) {
+		for _, sid := range ids {
+			if sid.IsRule() && !ret[sid] {
+				ret[sid] = true
+				visit(d.comp.Map[sid].IDs)
+			}
+		}
+	}
+	visit(ids)
+	return ret
+}
+
+// boundaries gives the offsets in bytes between the symbols, with the rules which are not shared
+// by the other input replaced by the symbols they contain, and at either end.
+func (d *differ) boundaries(ids SymbolIDslice, shared map[SymbolID]bool) map[int]bool {
+	ret := map[int]bool{0: true}
+	offset := 0
+	var visit func(ids SymbolIDslice)
+	visit = func(ids SymbolIDslice) {
+		for _, sid := range ids {
+			if sid.IsRule() && !shared[sid] {
+				visit(d.comp.Map[sid].IDs)
+				continue
+			}
+			offset += d.lengths[sid]
+			ret[offset] = true
+		}
+	}
+	visit(ids)
+	return ret
+}
+
+// align replaces the hunks by those of the blocks of changes.
+func (d *differ) align(blocks []diffBlock) {
+	end, endB := d.aPos, d.bPos
+	d.hunks, d.aPos, d.bPos = nil, 0, 0
+	for _, bl := range blocks {
+		d.emit(DiffEqual, bl.a0-d.aPos)
+		d.emit(DiffDelete, bl.a1-bl.a0)
+		d.emit(DiffInsert, bl.b1-bl.b0)
+	}
+	d.emit(DiffEqual, end-d.aPos)
+	if d.bPos != endB {
+		panic("misaligned hunks")
+	}
+}
+
+func (d *differ) emit(op DiffOp, length int) {
+	if length == 0 {
+		return
+	}
+	if n := len(d.hunks); n > 0 && d.hunks[n-1].Op == op {
+		d.hunks[n-1].Length += length
+	} else {
+		d.hunks = append(d.hunks, DiffHunk{Op: op, AOffset: d.aPos, BOffset: d.bPos, Length: length})
+	}
+	if op != DiffInsert {
+		d.aPos += length
+	}
+	if op != DiffDelete {
+		d.bPos += length
+	}
+}
+
+// compare emits the hunks turning x.ids[i0:i1] into y.ids[j0:j1], matching their common prefix and suffix,
+// then comparing the two halves either side of the middle of a shortest edit script between the rest.
+func (d *differ) compare(i0, i1, j0, j1 int) {
+	i, j := d.forward(i0, j0, i1, j1)
+	d.emit(DiffEqual, d.x.offsets[i]-d.x.offsets[i0])
+	k, l := d.backward(i1, j1, i, j)
+	if mi, mj, found := d.middle(i, k, j, l); found {
+		d.compare(i, mi, j, mj)
+		d.compare(mi, k, mj, l)
+	} else {
+		d.emit(DiffDelete, d.x.offsets[k]-d.x.offsets[i])
+		d.emit(DiffInsert, d.y.offsets[l]-d.y.offsets[j])
+	}
+	d.emit(DiffEqual, d.x.offsets[i1]-d.x.offsets[k])
+}
+
+// forward follows the runes or bytes which are equal from x.ids[i] and y.ids[j], up to x.ids[i1] and y.ids[j1],
+// skipping over the rules which begin at both, and gives where they differ.
+func (d *differ) forward(i, j, i1, j1 int) (int, int) {
+	for i < i1 && j < j1 && d.x.ids[i] == d.y.ids[j] {
+		if n := d.shared(d.x.starts[i], d.y.starts[j], 0, i1-i, j1-j); n > 0 {
+			i, j = i+n, j+n
+		} else {
+			i, j = i+1, j+1
+		}
+	}
+	return i, j
+}
+
+// backward follows the runes or bytes which are equal before x.ids[i] and y.ids[j], down to x.ids[i0] and y.ids[j0],
+// skipping over the rules which end at both, and gives where they differ.
+func (d *differ) backward(i, j, i0, j0 int) (int, int) {
+	for i > i0 && j > j0 && d.x.ids[i-1] == d.y.ids[j-1] {
+		if n := d.shared(d.x.ends[i-1], d.y.ends[j-1], -1, i-i0, j-j0); n > 0 {
+			i, j = i-n, j-n
+		} else {
+			i, j = i-1, j-1
+		}
+	}
+	return i, j
+}
+
+// shared finds the longest rule which both of the given rules begin with, or end with, by following the first,
+// or the last (-1), symbols they contain, and gives the number of runes or bytes in it, if it fits in both of
+// the given numbers of runes or bytes, or 0.
+func (d *differ) shared(r1, r2 SymbolID, child, room1, room2 int) int {
+	for r1.IsRule() && r2.IsRule() {
+		n1, n2 := d.counts[r1], d.counts[r2]
+		switch {
+		case r1 == r2 && n1 <= room1 && n1 <= room2:
+			return n1
+		case n1 >= n2:
+			r1 = d.child(r1, child)
+		default:
+			r2 = d.child(r2, child)
+		}
+	}
+	return 0
+}
+
+func (d *differ) child(sid SymbolID, child int) SymbolID {
+	ids := d.comp.Map[sid].IDs
+	if child < 0 {
+		return ids[len(ids)+child]
+	}
+	return ids[child]
+}
+
+// middle finds a point about halfway along a shortest edit script turning x.ids[i0:i1] into y.ids[j0:j1],
+// by following the furthest reaching paths from both ends at once until they meet, or false if they have nothing
+// in common. Their first and last runes or bytes must differ.
+func (d *differ) middle(i0, i1, j0, j1 int) (int, int, bool) {
+	n, m := i1-i0, j1-j0
+	if n == 0 || m == 0 {
+		return 0, 0, false
+	}
+	maxD := (n + m + 1) / 2
+	offset := maxD
+	// the furthest number of runes or bytes of x reached on each diagonal k, from the start and from the end, or -1
+	front := make([]int, 2*maxD+2)
+	back := make([]int, 2*maxD+2)
+	for k := range front {
+		front[k], back[k] = -1, -1
+	}
+	front[offset+1], back[offset+1] = 0, 0
+	delta := n - m
+	odd := delta%2 != 0
+	// the diagonals which have run off the end of x or y are not followed further
+	startF, endF, startB, endB := 0, 0, 0, 0
+	for e := 0; e < maxD; e++ {
+		for k := -e + startF; k <= e-endF; k += 2 {
+			var i int
+			if k == -e || (k != e && front[offset+k-1] < front[offset+k+1]) {
+				i = front[offset+k+1]
+			} else {
+				i = front[offset+k-1] + 1
+			}
+			j := i - k
+			if i <= n && j <= m {
+				i, j = d.forward(i0+i, j0+j, i1, j1)
+				i, j = i-i0, j-j0
+			}
+			front[offset+k] = i
+			switch {
+			case i > n:
+				endF += 2
+			case j > m:
+				startF += 2
+			case odd:
+				if b := offset + delta - k; b >= 0 && b < len(back) && back[b] != -1 && i >= n-back[b] {
+					return i0 + i, j0 + j, true
+				}
+			}
+		}
+		for k := -e + startB; k <= e-endB; k += 2 {
+			var i int
+			if k == -e || (k != e && back[offset+k-1] < back[offset+k+1]) {
+				i = back[offset+k+1]
+			} else {
+				i = back[offset+k-1] + 1
+			}
+			j := i - k
+			if i <= n && j <= m {
+				i, j = d.backward(i1-i, j1-j, i0, j0)
+				i, j = i1-i, j1-j
+			}
+			back[offset+k] = i
+			switch {
+			case i > n:
+				endB += 2
+			case j > m:
+				startB += 2
+			case !odd:
+				if f := offset + delta - k; f >= 0 && f < len(front) && front[f] != -1 && front[f] >= n-i {
+					return i0 + front[f], j0 + front[f] - (f - offset), true
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// WriteUnifiedDiff renders the hunks given by Diff(a, b) as a line-based unified diff,
+// with the given number of lines of context around each change.
+func WriteUnifiedDiff(w io.Writer, a, b []byte, hunks []DiffHunk, nameA, nameB string, context int) error {
+	blocks := lineBlocks(a, b, hunks)
+	if len(blocks) == 0 {
+		return nil
+	}
+	if _, err := fmt.Fprintf(w, "--- %s\n+++ %s\n", nameA, nameB); err != nil {
+		return err
+	}
+	linesA, linesB := splitLines(a), splitLines(b)
+	startsA := lineStarts(linesA)
+	startsB := lineStarts(linesB)
+	line := func(starts []int, offset int) int { return sort.SearchInts(starts, offset) }
+
+	for first := 0; first < len(blocks); {
+		last := first
+		for last+1 < len(blocks) &&
+			line(startsA, blocks[last+1].a0)-line(startsA, blocks[last].a1) <= 2*context {
+			last++
+		}
+		la0 := line(startsA, blocks[first].a0) - context
+		if la0 < 0 {
+			la0 = 0
+		}
+		la1 := line(startsA, blocks[last].a1) + context
+		if la1 > len(linesA) {
+			la1 = len(linesA)
+		}
+		lb0 := la0 - line(startsA, blocks[first].a0) + line(startsB, blocks[first].b0)
+		lb1 := la1 - line(startsA, blocks[last].a1) + line(startsB, blocks[last].b1)
+
+		if _, err := fmt.Fprintf(w, "@@ -%s +%s @@\n", unifiedRange(la0, la1), unifiedRange(lb0, lb1)); err != nil {
+			return err
+		}
+		la := la0
+		for bl := first; bl <= last; bl++ {
+			ba0, ba1 := line(startsA, blocks[bl].a0), line(startsA, blocks[bl].a1)
+			bb0, bb1 := line(startsB, blocks[bl].b0), line(startsB, blocks[bl].b1)
+			if err := writeLines(w, DiffEqual, linesA[la:ba0]); err != nil {
+				return err
+			}
+			if err := writeLines(w, DiffDelete, linesA[ba0:ba1]); err != nil {
+				return err
+			}
+			if err := writeLines(w, DiffInsert, linesB[bb0:bb1]); err != nil {
+				return err
+			}
+			la = ba1
+		}
+		if err := writeLines(w, DiffEqual, linesA[la:la1]); err != nil {
+			return err
+		}
+		first = last + 1
+	}
+	return nil
+}
+
+// diffBlock is a change between a[a0:a1] and b[b0:b1], made of the hunks between two DiffEqual hunks.
+type diffBlock struct{ a0, a1, b0, b1 int }
+
+// changeBlocks groups the changes in hunks into blocks.
+// The text between two blocks is equal in a and b.
+func changeBlocks(hunks []DiffHunk) []diffBlock {
+	var blocks []diffBlock
+	for _, h := range hunks {
+		if h.Op == DiffEqual {
+			continue
+		}
+		end := h.AOffset
+		endB := h.BOffset
+		if h.Op == DiffDelete {
+			end += h.Length
+		} else {
+			endB += h.Length
+		}
+		if n := len(blocks); n > 0 && blocks[n-1].a1 == h.AOffset && blocks[n-1].b1 == h.BOffset {
+			blocks[n-1].a1, blocks[n-1].b1 = end, endB
+		} else {
+			blocks = append(blocks, diffBlock{h.AOffset, end, h.BOffset, endB})
+		}
+	}
+	return blocks
+}
+
+// alignBlocks widens the blocks until they begin and end at offsets in a and b at which at holds,
+// or at the ends of a and b, merging the blocks which meet. The offsets 0 in a and b must be such offsets.
+func alignBlocks(blocks []diffBlock, lenA, lenB int, at func(a, b int) bool) []diffBlock {
+	var ret []diffBlock
+	for i := 0; i < len(blocks); i++ {
+		bl := blocks[i]
+		prevEnd := 0
+		if len(ret) > 0 {
+			prevEnd = ret[len(ret)-1].a1
+		}
+		for !at(bl.a0, bl.b0) {
+			if bl.a0 == prevEnd {
+				// the block starts in the previous block
+				prev := ret[len(ret)-1]
+				ret = ret[:len(ret)-1]
+				bl.a0, bl.b0 = prev.a0, prev.b0
+				break
+			}
+			bl.a0--
+			bl.b0--
+		}
+		for !at(bl.a1, bl.b1) && !(bl.a1 == lenA && bl.b1 == lenB) {
+			if i+1 < len(blocks) && bl.a1 == blocks[i+1].a0 {
+				// the block ends in the next block
+				i++
+				bl.a1, bl.b1 = blocks[i].a1, blocks[i].b1
+				continue
+			}
+			bl.a1++
+			bl.b1++
+		}
+		ret = append(ret, bl)
+	}
+	return ret
+}
+
+// lineBlocks groups the changes in hunks into blocks of whole lines, where all of the offsets are at the start of
+// a line (or the end of the input). The text between two blocks is equal in a and b, so it is made of the same lines.
+func lineBlocks(a, b []byte, hunks []DiffHunk) []diffBlock {
+	atLineStart := func(s []byte, offset int) bool { return offset == 0 || s[offset-1] == '\n' }
+	return alignBlocks(changeBlocks(hunks), len(a), len(b), func(i, j int) bool {
+		return atLineStart(a, i) && atLineStart(b, j)
+	})
+}
+
+func splitLines(s []byte) [][]byte {
+	lines := bytes.SplitAfter(s, []byte("\n"))
+	if len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// lineStarts gives the offset of the start of each line, and of the end of the input.
+func lineStarts(lines [][]byte) []int {
+	ret := make([]int, len(lines)+1)
+	for i, l := range lines {
+		ret[i+1] = ret[i] + len(l)
+	}
+	return ret
+}
+
+func unifiedRange(l0, l1 int) string {
+	if l1-l0 == 0 {
+		return fmt.Sprintf("%d,0", l0)
+	}
+	if l1-l0 == 1 {
+		return fmt.Sprint(l0 + 1)
+	}
+	return fmt.Sprintf("%d,%d", l0+1, l1-l0)
+}
+
+func writeLines(w io.Writer, op DiffOp, lines [][]byte) error {
+	for _, l := range lines {
+		if _, err := fmt.Fprint(w, op, string(l)); err != nil {
+			return err
+		}
+		if !bytes.HasSuffix(l, []byte("\n")) {
+			if _, err := fmt.Fprint(w, "\n\\ No newline at end of file\n"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
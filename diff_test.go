@@ -0,0 +1,168 @@
+package sequitur
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+	"testing/quick"
+)
+
+// applyDiff rebuilds b from a and the hunks given by Diff(a, b).
+func applyDiff(t *testing.T, a, b []byte, hunks []DiffHunk) []byte {
+	var ret []byte
+	aPos, bPos := 0, 0
+	for k, h := range hunks {
+		if h.AOffset != aPos || h.BOffset != bPos {
+			t.Fatalf("hunk %d %+v at wrong offset, want %d %d", k, h, aPos, bPos)
+		}
+		if k > 0 && hunks[k-1].Op == h.Op {
+			t.Fatalf("hunk %d %+v has the same Op as the previous hunk", k, h)
+		}
+		switch h.Op {
+		case DiffEqual:
+			if !bytes.Equal(a[aPos:aPos+h.Length], b[bPos:bPos+h.Length]) {
+				t.Fatalf("hunk %d %+v not equal", k, h)
+			}
+			ret = append(ret, a[aPos:aPos+h.Length]...)
+			aPos += h.Length
+			bPos += h.Length
+		case DiffDelete:
+			aPos += h.Length
+		case DiffInsert:
+			ret = append(ret, b[bPos:bPos+h.Length]...)
+			bPos += h.Length
+		}
+	}
+	if aPos != len(a) || bPos != len(b) {
+		t.Fatalf("hunks end at %d %d, want %d %d", aPos, bPos, len(a), len(b))
+	}
+	return ret
+}
+
+func TestDiff(t *testing.T) {
+	a := []byte(testImportance)
+	b := []byte(strings.Replace(strings.Replace(testImportance, "Rule utility", "Rule usefulness", 1), "\nS→BB, B→aba.\n", "\n", 1))
+	hunks := Diff(a, b)
+	if got := applyDiff(t, a, b, hunks); !bytes.Equal(got, b) {
+		t.Error("hunks do not rebuild b")
+	}
+	// the changes are widened to the rules around them
+	if changed := changedBytes(hunks); changed > 50 {
+		t.Error("too many bytes changed:", changed, hunks)
+	}
+
+	f := func(a, b []byte) bool {
+		return bytes.Equal(applyDiff(t, a, b, Diff(a, b)), b)
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Error(err)
+	}
+	g := func(a, b []byte) bool {
+		ab := concat(a, b)
+		ba := concat(b, a)
+		return bytes.Equal(applyDiff(t, ab, ba, Diff(ab, ba)), ba)
+	}
+	if err := quick.Check(g, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+// myersDistance gives the number of bytes deleted and inserted by a shortest edit script turning a into b.
+func myersDistance(a, b []byte) int {
+	n, m := len(a), len(b)
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+	for e := 0; ; e++ {
+		for k := -e; k <= e; k += 2 {
+			var i int
+			if k == -e || (k != e && v[offset+k-1] < v[offset+k+1]) {
+				i = v[offset+k+1]
+			} else {
+				i = v[offset+k-1] + 1
+			}
+			j := i - k
+			for i < n && j < m && a[i] == b[j] {
+				i++
+				j++
+			}
+			v[offset+k] = i
+			if i >= n && j >= m {
+				return e
+			}
+		}
+	}
+}
+
+func TestDiffMinimal(t *testing.T) {
+	files, ins := testFiles(t)
+	rnd := rand.New(rand.NewSource(1))
+	for f, a := range ins {
+		for edits := 1; edits <= 8; edits++ {
+			b := append([]byte{}, a...)
+			for e := 0; e < edits; e++ {
+				p := rnd.Intn(len(b))
+				switch rnd.Intn(3) {
+				case 0:
+					b[p] = byte('a' + rnd.Intn(26))
+				case 1:
+					b = append(b[:p], b[p+1:]...)
+				default:
+					b = append(b[:p], append([]byte{'x'}, b[p:]...)...)
+				}
+			}
+			d := diff(a, b)
+			if got := applyDiff(t, a, b, d.hunks); !bytes.Equal(got, b) {
+				t.Fatalf("%s: hunks do not rebuild b", files[f])
+			}
+			if changed, want := changedBytes(d.hunks), myersDistance(a, b); changed != want {
+				t.Errorf("%s with %d edits: %d bytes changed, a Myers diff changes %d", files[f], edits, changed, want)
+			}
+
+			hunks := Diff(a, b)
+			if got := applyDiff(t, a, b, hunks); !bytes.Equal(got, b) {
+				t.Fatalf("%s: aligned hunks do not rebuild b", files[f])
+			}
+			if changedBytes(hunks) < changedBytes(d.hunks) {
+				t.Errorf("%s with %d edits: aligning the hunks changed fewer bytes", files[f], edits)
+			}
+			for _, bl := range changeBlocks(hunks) {
+				if !d.atA[bl.a0] || !d.atB[bl.b0] || !d.atA[bl.a1] || !d.atB[bl.b1] {
+					t.Errorf("%s with %d edits: change %+v not at the boundaries of shared rules", files[f], edits, bl)
+				}
+			}
+		}
+	}
+}
+
+// changedBytes gives the number of bytes deleted and inserted by the hunks.
+func changedBytes(hunks []DiffHunk) int {
+	changed := 0
+	for _, h := range hunks {
+		if h.Op != DiffEqual {
+			changed += h.Length
+		}
+	}
+	return changed
+}
+
+func ExampleWriteUnifiedDiff() {
+
+	a := []byte(testString[:120])
+	b := []byte(strings.Replace(testString[:120], "some like it cold", "some like it hot", 1) + "no newline")
+
+	if err := WriteUnifiedDiff(os.Stdout, a, b, Diff(a, b), "a", "b", 1); err != nil {
+		panic(err)
+	}
+
+	// Output:
+	// --- a
+	// +++ b
+	// @@ -7,2 +7,2 @@
+	//  some like it hot,
+	// -some like it cold
+	// \ No newline at end of file
+	// +some like it hotno newline
+	// \ No newline at end of file
+}
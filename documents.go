@@ -0,0 +1,99 @@
+package sequitur
+
+// Documents is a grammar shared by several documents, built by ParseDocuments.
+// A SymbolID names the same rule in every document, giving a common vocabulary across them.
+type Documents struct {
+	Rules *Compact           // the shared grammar, whose root is the concatenation of the Roots
+	Roots []SymbolIDslice    // the top-level symbols of each document
+	Usage []map[SymbolID]int // the number of times each rule occurs in the expansion of each document
+	docs  map[SymbolID][]int // the documents using each rule
+}
+
+// ParseDocuments parses the documents into one grammar. The documents are separated by boundary symbols
+// which are unique, so never repeat as part of a digram, which ensures that no rule spans two documents.
+func ParseDocuments(docs [][]byte) *Documents {
+	g := newGrammar()
+	boundaries := make(map[SymbolID]bool)
+	for i, doc := range docs {
+		if i > 0 {
+			b := g.nextID() // not a rule, so a terminal symbol unlike any other
+			boundaries[SymbolID(b)] = true
+			g.appendValue(b)
+		}
+		g.appendBytes(doc)
+	}
+
+	comp := g.Compact()
+	d := &Documents{
+		Rules: comp,
+		Roots: make([]SymbolIDslice, len(docs)),
+		Usage: make([]map[SymbolID]int, len(docs)),
+		docs:  make(map[SymbolID][]int),
+	}
+	if comp.RootID != EmptySymbolID {
+		root := comp.Map[comp.RootID]
+		joined := make(SymbolIDslice, 0, len(root.IDs))
+		doc := 0
+		for _, sid := range root.IDs {
+			if boundaries[sid] {
+				doc++
+				continue
+			}
+			d.Roots[doc] = append(d.Roots[doc], sid)
+			joined = append(joined, sid)
+		}
+		if len(joined) == 0 { // only boundaries
+			delete(comp.Map, comp.RootID)
+			comp.RootID = EmptySymbolID
+		} else {
+			root.IDs = joined
+			comp.Map[comp.RootID] = root
+		}
+	}
+
+	for i := range docs {
+		occ := d.Compact(i).occurrences()
+		delete(occ, comp.RootID)
+		d.Usage[i] = occ
+		for sid := range occ {
+			d.docs[sid] = append(d.docs[sid], i)
+		}
+	}
+	return d
+}
+
+// Compact gives the grammar of document i alone: its root and the shared rules it uses,
+// with the Used count of each rule being the number of references to it from within this grammar.
+func (d *Documents) Compact(i int) *Compact {
+	ret := &Compact{
+		RootID: EmptySymbolID,
+		Map:    make(map[SymbolID]CompactEntry),
+	}
+	if len(d.Roots[i]) == 0 {
+		return ret
+	}
+	ret.RootID = d.Rules.RootID
+	ret.Map[ret.RootID] = CompactEntry{IDs: d.Roots[i]}
+	var add func(ids SymbolIDslice)
+	add = func(ids SymbolIDslice) {
+		for _, sid := range ids {
+			if !sid.IsRule() {
+				continue
+			}
+			entry, exists := ret.Map[sid]
+			if !exists {
+				entry.IDs = d.Rules.Map[sid].IDs
+				add(entry.IDs)
+			}
+			entry.Used++
+			ret.Map[sid] = entry
+		}
+	}
+	add(d.Roots[i])
+	return ret
+}
+
+// Containing lists, in ascending order, the documents whose expansion includes the rule.
+func (d *Documents) Containing(sid SymbolID) []int {
+	return d.docs[sid]
+}
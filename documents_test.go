@@ -0,0 +1,76 @@
+package sequitur
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func ExampleParseDocuments() {
+	d := ParseDocuments([][]byte{
+		[]byte("the cat sat on the mat"),
+		[]byte("the dog sat on the log"),
+		[]byte("a cat and a dog"),
+	})
+
+	for _, sid := range d.Rules.topologicalOrder() {
+		if sid == d.Rules.RootID {
+			continue
+		}
+		fmt.Printf("%q %v\n", d.Rules.Bytes(sid), d.Containing(sid))
+	}
+
+	// Output:
+	// "a " [2]
+	// "dog" [1 2]
+	// "og" [1 2]
+	// "sat on the " [0 1]
+	// "cat " [0 2]
+	// "at " [0 1 2]
+	// "at" [0 1 2]
+	// "the " [0 1]
+}
+
+func TestParseDocuments(t *testing.T) {
+	docs := [][]byte{
+		[]byte(testImportance[:2000]),
+		nil,
+		[]byte(testImportance[1000:3000]),
+		[]byte("aaaa"),
+		[]byte("aaaa"),
+	}
+	d := ParseDocuments(docs)
+	for i, doc := range docs {
+		comp := d.Compact(i)
+		if got := comp.Bytes(comp.RootID); !bytes.Equal(got, doc) {
+			t.Errorf("document %d: got %q", i, got)
+		}
+		if got := d.Roots[i].Bytes(d.Rules); !bytes.Equal(got, doc) {
+			t.Errorf("document %d root: got %q", i, got)
+		}
+		for sid, n := range d.Usage[i] {
+			if got := len(comp.Positions(sid)); got != n {
+				t.Errorf("document %d rule %v: usage %d, positions %d", i, sid, n, got)
+			}
+		}
+	}
+	if got := d.Rules.Bytes(d.Rules.RootID); !bytes.Equal(got, bytes.Join(docs, nil)) {
+		t.Error("joined documents", string(got))
+	}
+	shared := 0
+	for sid := range d.Rules.Map {
+		if sid != d.Rules.RootID && len(d.Containing(sid)) > 1 {
+			shared++
+		}
+	}
+	if shared == 0 {
+		t.Error("no rules shared between documents")
+	}
+	if in := d.Containing(d.Roots[3][0]); len(in) != 2 || in[0] != 3 || in[1] != 4 {
+		t.Error("documents containing aa", in)
+	}
+
+	if d := ParseDocuments([][]byte{nil, nil}); d.Rules.RootID != EmptySymbolID || d.Compact(1).RootID != EmptySymbolID {
+		t.Error("empty documents", d.Rules)
+	}
+}
@@ -0,0 +1,166 @@
+package sequitur
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"math"
+	"sort"
+)
+
+// Fingerprint is a MinHash signature of the set of []byte represented by the symbols of a CompactIndexed.
+// The proportion of equal values in two Fingerprints estimates the Jaccard similarity of the two sets.
+// For weighted Fingerprints it estimates their probability Jaccard similarity, as in P-MinHash, rather than their
+// weighted Jaccard similarity: the coverages of each grammar are compared as proportions of their total,
+// so scaling all of the weights of either grammar makes no difference.
+type Fingerprint []uint64
+
+// Fingerprint computes a MinHash signature of the given size for the grammar,
+// optionally weighting each symbol by its coverage.
+func (ci *CompactIndexed) Fingerprint(size int, weighted bool) Fingerprint {
+	fp := make(Fingerprint, size)
+	if ci == nil || size <= 0 {
+		return fp
+	}
+	best := make([]float64, size)
+	for i := range best {
+		best[i] = math.Inf(1)
+	}
+	for str, sid := range ci.StringToID {
+		h := hashString(str)
+		w := 1.0
+		if weighted {
+			w = ci.IDinfo[sid].Coverage
+			if w <= 0 {
+				continue
+			}
+		}
+		for i := range fp {
+			// the minimum of exponentially distributed keys with rate w selects each symbol in proportion to its weight
+			u := float64(mix64(h^slotSeed(i))>>11+1) / (1 << 53)
+			if key := -math.Log(u) / w; key < best[i] {
+				best[i] = key
+				fp[i] = h
+			}
+		}
+	}
+	return fp
+}
+
+// Similarity estimates the Jaccard similarity between the sets of symbols of two Fingerprints of the same size.
+func (fp Fingerprint) Similarity(fp2 Fingerprint) float64 {
+	if len(fp) == 0 || len(fp) != len(fp2) {
+		return 0
+	}
+	same := 0
+	for i, v := range fp {
+		if v == fp2[i] {
+			same++
+		}
+	}
+	return float64(same) / float64(len(fp))
+}
+
+// MarshalBinary encodes a Fingerprint as 8 little-endian bytes per value.
+func (fp Fingerprint) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 8*len(fp))
+	for i, v := range fp {
+		binary.LittleEndian.PutUint64(b[8*i:], v)
+	}
+	return b, nil
+}
+
+// UnmarshalBinary decodes a Fingerprint encoded by MarshalBinary.
+func (fp *Fingerprint) UnmarshalBinary(data []byte) error {
+	if len(data)%8 != 0 {
+		return errors.New("sequitur: Fingerprint data length is not a multiple of 8")
+	}
+	ret := make(Fingerprint, len(data)/8)
+	for i := range ret {
+		ret[i] = binary.LittleEndian.Uint64(data[8*i:])
+	}
+	*fp = ret
+	return nil
+}
+
+// LSHIndex is a locality-sensitive hashing index of Fingerprints, using the banding technique:
+// each Fingerprint is split into Bands bands of Rows values, and documents agreeing on all the values
+// of any band are candidate near-duplicates. The probability of two documents with similarity s being
+// candidates is 1-(1-s^Rows)^Bands.
+type LSHIndex struct {
+	Bands, Rows int
+	buckets     []map[uint64][]int
+}
+
+// NewLSHIndex returns an empty LSHIndex, for Fingerprints of at least bands*rows values.
+func NewLSHIndex(bands, rows int) *LSHIndex {
+	idx := &LSHIndex{
+		Bands:   bands,
+		Rows:    rows,
+		buckets: make([]map[uint64][]int, bands),
+	}
+	for b := range idx.buckets {
+		idx.buckets[b] = make(map[uint64][]int)
+	}
+	return idx
+}
+
+// ErrFingerprintSize is returned when a Fingerprint is too short for an LSHIndex.
+var ErrFingerprintSize = errors.New("sequitur: Fingerprint shorter than LSHIndex bands*rows")
+
+// Add the Fingerprint of a document to the index, under the caller's document number.
+func (idx *LSHIndex) Add(doc int, fp Fingerprint) error {
+	if len(fp) < idx.Bands*idx.Rows {
+		return ErrFingerprintSize
+	}
+	for b, bucket := range idx.buckets {
+		key := idx.bandKey(b, fp)
+		bucket[key] = append(bucket[key], doc)
+	}
+	return nil
+}
+
+// Candidates lists, in ascending order, the documents sharing at least one band with the Fingerprint.
+// The candidates should be verified, for example with Fingerprint.Similarity or CompactIndexed.Similarity.
+func (idx *LSHIndex) Candidates(fp Fingerprint) ([]int, error) {
+	if len(fp) < idx.Bands*idx.Rows {
+		return nil, ErrFingerprintSize
+	}
+	seen := make(map[int]bool)
+	ret := []int{}
+	for b, bucket := range idx.buckets {
+		for _, doc := range bucket[idx.bandKey(b, fp)] {
+			if !seen[doc] {
+				seen[doc] = true
+				ret = append(ret, doc)
+			}
+		}
+	}
+	sort.Ints(ret)
+	return ret, nil
+}
+
+func (idx *LSHIndex) bandKey(b int, fp Fingerprint) uint64 {
+	key := slotSeed(b)
+	for _, v := range fp[b*idx.Rows : (b+1)*idx.Rows] {
+		key = mix64(key ^ v)
+	}
+	return key
+}
+
+func hashString(s string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(s)) // never returns an error
+	return h.Sum64()
+}
+
+func slotSeed(i int) uint64 {
+	return mix64(uint64(i+1) * 0x9e3779b97f4a7c15)
+}
+
+// mix64 is the finalizer of the splitmix64 generator.
+func mix64(z uint64) uint64 {
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
@@ -0,0 +1,74 @@
+package sequitur
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFingerprint(t *testing.T) {
+	texts := []string{
+		testImportance,
+		strings.Replace(testImportance, "grammar", "gramme", 3),
+		testSimilarity,
+		testString,
+		testCompact,
+	}
+	cis := make([]*CompactIndexed, len(texts))
+	for i, text := range texts {
+		cis[i] = Parse([]byte(text)).Compact().Index(nil)
+	}
+
+	idx := NewLSHIndex(32, 4)
+	for i, ci := range cis {
+		fp := ci.Fingerprint(128, false)
+		if est, want := fp.Similarity(cis[0].Fingerprint(128, false)), Jaccard(ci, cis[0]); math.Abs(est-want) > 0.15 {
+			t.Errorf("document %d estimated Jaccard similarity %v, want %v", i, est, want)
+		}
+		if err := idx.Add(i, fp); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	candidates, err := idx.Candidates(cis[1].Fingerprint(128, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{0, 1}; !reflect.DeepEqual(candidates, want) {
+		t.Errorf("candidates %v, want %v", candidates, want)
+	}
+
+	if _, err := idx.Candidates(make(Fingerprint, 10)); err != ErrFingerprintSize {
+		t.Error("short Fingerprint accepted:", err)
+	}
+}
+
+func TestFingerprintWeighted(t *testing.T) {
+	ci := Parse([]byte(testImportance)).Compact().Index(nil)
+	fp := ci.Fingerprint(64, true)
+	if s := fp.Similarity(ci.Fingerprint(64, true)); s != 1 {
+		t.Error("Fingerprint not deterministic:", s)
+	}
+	if s := fp.Similarity(Parse([]byte(testString)).Compact().Index(nil).Fingerprint(64, true)); s > 0.2 {
+		t.Error("unrelated documents too similar:", s)
+	}
+}
+
+func TestFingerprintMarshal(t *testing.T) {
+	fp := Parse([]byte(testString)).Compact().Index(nil).Fingerprint(16, false)
+	b, err := fp.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fp2 Fingerprint
+	if err := fp2.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fp, fp2) {
+		t.Error("Fingerprint changed by MarshalBinary/UnmarshalBinary", fp, fp2)
+	}
+	if err := fp2.UnmarshalBinary(b[1:]); err == nil {
+		t.Error("UnmarshalBinary accepted truncated data")
+	}
+}
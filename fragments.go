@@ -250,7 +250,13 @@ type CompactIndexed struct {
 	OriginalInputLength int
 	TotalCoverage       float64
 	StringToID          map[string]SymbolID
+	HashToID            map[ContentHash]SymbolID // the same symbols as StringToID, by their ContentHash
 	IDinfo              map[SymbolID]CompactIndexedInfo
+
+	// kept by Index, so that the similarity metrics need not compute them again for each comparison
+	hashes     map[SymbolID]ContentHash // the ContentHash of every symbol of CompactBasis
+	expansions map[SymbolID]string      // the keys of StringToID, by their SymbolID
+	counts     map[ContentHash]int      // the result of hashCounts
 }
 
 // CompactIndexedInfo stores derrived information about a Symbol.
@@ -266,7 +272,10 @@ func (comp *Compact) Index(filterKeep func([]byte) bool) *CompactIndexed {
 	ret := &CompactIndexed{
 		CompactBasis: comp,
 		StringToID:   make(map[string]SymbolID),
+		HashToID:     make(map[ContentHash]SymbolID),
 		IDinfo:       make(map[SymbolID]CompactIndexedInfo),
+		hashes:       comp.Hashes(),
+		expansions:   make(map[SymbolID]string),
 	}
 	if filterKeep == nil {
 		filterKeep = func([]byte) bool { return true }
@@ -277,7 +286,10 @@ func (comp *Compact) Index(filterKeep func([]byte) bool) *CompactIndexed {
 			ret.OriginalInputLength = len(b)
 		}
 		if filterKeep(b) {
-			ret.StringToID[string(b)] = k
+			str := string(b)
+			ret.StringToID[str] = k
+			ret.HashToID[ret.hashes[k]] = k
+			ret.expansions[k] = str
 			ret.IDinfo[k] = CompactIndexedInfo{
 				Coverage: float64(len(b)),
 			}
@@ -288,6 +300,7 @@ func (comp *Compact) Index(filterKeep func([]byte) bool) *CompactIndexed {
 		ret.IDinfo[k] = v
 		ret.TotalCoverage += v.Coverage
 	}
+	ret.counts = ret.hashCounts()
 	return ret
 }
 
@@ -322,23 +335,164 @@ func (ci *CompactIndexed) Importance(scoreFn func(SymbolID) float64) []Importanc
 }
 
 // Similarity between two CompactIndexed grammars. Result: 1 (or nearby) equality, 0 inequality.
+// It is the CoverageOverlap metric, see SimilarityWith for the alternatives.
 func (ci *CompactIndexed) Similarity(ci2 *CompactIndexed) float64 {
-	if ci == nil || ci2 == nil {
-		return 0
+	return coverageOverlap(ci, ci2)
+}
+
+// Positions gives the byte offsets in the original input of every occurrence of a SymbolID, in ascending order.
+func (comp *Compact) Positions(sid SymbolID) []int {
+	if comp == nil || comp.RootID == EmptySymbolID {
+		return nil
+	}
+	return comp.positions(map[SymbolID]bool{sid: true})[sid]
+}
+
+// positions gives the byte offsets of every occurrence of the wanted SymbolIDs, in a single pass over the input.
+func (comp *Compact) positions(want map[SymbolID]bool) map[SymbolID][]int {
+	ret := make(map[SymbolID][]int, len(want))
+	if comp == nil || comp.RootID == EmptySymbolID {
+		return ret
+	}
+	lengths := comp.lengths()
+	var walk func(sid SymbolID, off int)
+	walk = func(sid SymbolID, off int) {
+		if want[sid] {
+			ret[sid] = append(ret[sid], off)
+		}
+		if !sid.IsRule() {
+			return
+		}
+		for _, child := range comp.Map[sid].IDs {
+			walk(child, off)
+			off += lengths[child]
+		}
+	}
+	walk(comp.RootID, 0)
+	return ret
+}
+
+// lengths gives the length in bytes of every symbol reachable from the root.
+func (comp *Compact) lengths() map[SymbolID]int {
+	ret := make(map[SymbolID]int)
+	var length func(sid SymbolID) int
+	length = func(sid SymbolID) int {
+		if l, ok := ret[sid]; ok {
+			return l
+		}
+		l := 0
+		if sid.IsRule() {
+			for _, child := range comp.Map[sid].IDs {
+				l += length(child)
+			}
+		} else {
+			l = len(runeOrByte(sid).appendBytes(make([]byte, 0, utf8.UTFMax)))
+		}
+		ret[sid] = l
+		return l
+	}
+	length(comp.RootID)
+	return ret
+}
+
+// Inline removes a rule from the grammar, replacing each of its uses with its IDs and updating the Used counts
+// of the rules it uses, so that the expansion of the grammar is unchanged. It does nothing if sid is the root,
+// or not a rule of the grammar.
+func (comp *Compact) Inline(sid SymbolID) {
+	if comp == nil || sid == comp.RootID {
+		return
+	}
+	entry, exists := comp.Map[sid]
+	if !exists {
+		return
+	}
+	delete(comp.Map, sid)
+	uses := 0
+	for k, v := range comp.Map {
+		n := 0
+		for _, id := range v.IDs {
+			if id == sid {
+				n++
+			}
+		}
+		if n == 0 {
+			continue
+		}
+		ids := make(SymbolIDslice, 0, len(v.IDs)+n*(len(entry.IDs)-1))
+		for _, id := range v.IDs {
+			if id == sid {
+				ids = append(ids, entry.IDs...)
+			} else {
+				ids = append(ids, id)
+			}
+		}
+		v.IDs = ids
+		comp.Map[k] = v
+		uses += n
+	}
+	for _, id := range entry.IDs {
+		if child, isRule := comp.Map[id]; isRule {
+			child.Used += uses - 1
+			comp.Map[id] = child
+		}
+	}
+}
+
+// Prune inlines every rule other than the root for which keep returns false, so that, for example, only rules
+// of a minimum length or usage remain. The rules are considered with every rule before the rules it contains,
+// so the entry passed to keep reflects the rules already inlined which used it.
+func (comp *Compact) Prune(keep func(SymbolID, CompactEntry) bool) {
+	if comp == nil || comp.RootID == EmptySymbolID {
+		return
+	}
+	for _, sid := range comp.topologicalOrder() {
+		if sid != comp.RootID && !keep(sid, comp.Map[sid]) {
+			comp.Inline(sid)
+		}
+	}
+}
+
+// Canonicalize renumbers the rules in the order in which they first occur in the expansion of the root,
+// from left to right, with the root numbered as by Parse, so that grammars with the same structure have
+// the same SymbolIDs however they were built. Rules which are not reachable from the root are removed,
+// and the Used counts of the rest reflect only the rules which remain.
+func (comp *Compact) Canonicalize() {
+	if comp == nil || comp.RootID == EmptySymbolID {
+		return
 	}
-	cumCoverage := 0.0
-	if len(ci2.StringToID) < len(ci.StringToID) {
-		ci2, ci = ci, ci2 // swap to iterate over ci2 if it is shorter
+	next := SymbolID(rootRuleID)
+	ids := map[SymbolID]SymbolID{comp.RootID: next}
+	var number func(sid SymbolID)
+	number = func(sid SymbolID) {
+		for _, child := range comp.Map[sid].IDs {
+			if _, done := ids[child]; child.IsRule() && !done {
+				next++
+				ids[child] = next
+				number(child)
+			}
+		}
 	}
-	for str, sid := range ci.StringToID {
-		sid2, found := ci2.StringToID[str]
-		if found {
-			cumCoverage += ci.IDinfo[sid].Coverage + ci2.IDinfo[sid2].Coverage
+	number(comp.RootID)
+
+	// the rules removed may have used the rules which remain, so their uses are counted again
+	renumbered := make(map[SymbolID]CompactEntry, len(ids))
+	used := make(map[SymbolID]int, len(ids))
+	for sid, id := range ids {
+		entry := comp.Map[sid]
+		body := make(SymbolIDslice, len(entry.IDs))
+		for i, child := range entry.IDs {
+			if child.IsRule() {
+				child = ids[child]
+				used[child]++
+			}
+			body[i] = child
 		}
+		renumbered[id] = CompactEntry{IDs: body}
 	}
-	divisor := (ci.TotalCoverage + ci2.TotalCoverage)
-	if divisor == 0 {
-		return 1 // two empty grammars are equal
+	for id, entry := range renumbered {
+		entry.Used = used[id]
+		renumbered[id] = entry
 	}
-	return cumCoverage / divisor
+	comp.RootID = ids[comp.RootID]
+	comp.Map = renumbered
 }
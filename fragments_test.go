@@ -56,3 +56,111 @@ func TestEmpty(t *testing.T) {
 	}
 
 }
+
+func ExampleCompact_Prune() {
+
+	comp := Parse([]byte(testCompact)).Compact()
+	comp.Prune(func(sid SymbolID, entry CompactEntry) bool {
+		return len(comp.Bytes(sid)) >= 4
+	})
+
+	var output bytes.Buffer
+	if err := comp.PrettyPrint(&output); err != nil {
+		panic(err)
+	}
+
+	fmt.Println(string(output.Bytes()))
+
+	// Output:
+	// 1114369 -> {0 [R 1114374 a n d   r 1114374 1114385 o c k s ,   1114385 a s c a l   r a n .]}
+	// 1114374 -> {2 [o u n d  ]}
+	// 1114385 -> {2 [t h e   r a g g e d   r]}
+}
+
+func TestPrune(t *testing.T) {
+	for _, test := range [][]byte{[]byte(testString), testBinary, []byte(testCompact)} {
+		for minUsed := 2; minUsed < 6; minUsed++ {
+			comp := Parse(test).Compact()
+			comp.Prune(func(sid SymbolID, entry CompactEntry) bool {
+				return entry.Used >= minUsed
+			})
+			if !bytes.Equal(comp.Bytes(comp.RootID), test) {
+				t.Errorf("%d: expansion changed to %q", minUsed, comp.Bytes(comp.RootID))
+			}
+			if err := checkUsed(comp, minUsed); err != nil {
+				t.Errorf("%d: %v", minUsed, err)
+			}
+		}
+	}
+
+	comp := Parse([]byte(testCompact)).Compact()
+	size := len(comp.Map)
+	comp.Inline(comp.RootID)
+	comp.Inline('a')
+	if len(comp.Map) != size {
+		t.Errorf("inlined the root or a terminal")
+	}
+}
+
+func ExampleCompact_Canonicalize() {
+
+	comp := Parse([]byte(testCompact)).Compact()
+	comp.Canonicalize()
+
+	var output bytes.Buffer
+	if err := comp.PrettyPrint(&output); err != nil {
+		panic(err)
+	}
+
+	fmt.Println(string(output.Bytes()))
+
+	// Output:
+	// 1114369 -> {0 [R 1114370 a 1114371 r 1114370 1114373 o c k s ,   1114373 a s c a l 1114374 n .]}
+	// 1114370 -> {2 [o u 1114371]}
+	// 1114371 -> {2 [n 1114372]}
+	// 1114372 -> {2 [d  ]}
+	// 1114373 -> {2 [t h e 1114374 g g e 1114372 r]}
+	// 1114374 -> {2 [  r a]}
+}
+
+func TestCanonicalize(t *testing.T) {
+	for _, test := range [][]byte{[]byte(testString), testBinary, []byte(testCompact)} {
+		want := Parse(test).Compact()
+		want.Canonicalize()
+		var b bytes.Buffer
+		if err := want.PrettyPrint(&b); err != nil {
+			t.Fatal(err)
+		}
+		for _, chunks := range []int{1, 3} {
+			got := ParseParallel(test, Options{}, chunks).Compact()
+			got.Canonicalize()
+			if !bytes.Equal(got.Bytes(got.RootID), test) {
+				t.Errorf("%d chunks: expansion changed", chunks)
+			}
+			var b2 bytes.Buffer
+			if err := got.PrettyPrint(&b2); err != nil {
+				t.Fatal(err)
+			}
+			if chunks == 1 && b2.String() != b.String() {
+				t.Errorf("got\n%s\nwant\n%s", b2.String(), b.String())
+			}
+		}
+	}
+	empty := Parse(nil).Compact()
+	empty.Canonicalize()
+	if empty.RootID != EmptySymbolID {
+		t.Errorf("empty grammar gave %v", empty)
+	}
+
+	const root, r1, r2 = SymbolID(rootRuleID), SymbolID(rootRuleID + 1), SymbolID(rootRuleID + 2)
+	const a, b, x SymbolID = 'a' + 256, 'b' + 256, 'x' + 256
+	unreachable := &Compact{RootID: root, Map: map[SymbolID]CompactEntry{
+		root: {IDs: SymbolIDslice{r1, x, r1}},
+		r1:   {Used: 3, IDs: SymbolIDslice{a, b}},
+		r2:   {Used: 0, IDs: SymbolIDslice{r1, x}},
+	}}
+	unreachable.Canonicalize()
+	if err := checkUsed(unreachable, 2); err != nil || len(unreachable.Map) != 2 {
+		t.Errorf("removing an unreachable rule gave %v: %v", unreachable, err)
+	}
+}
@@ -0,0 +1,126 @@
+package sequitur
+
+import (
+	"math/bits"
+	"unicode/utf8"
+)
+
+// ContentHash identifies the []byte represented by a symbol, so that symbols with the same expansion have the same
+// ContentHash, in any grammar and however their rules are structured. It is the length of the expansion with two
+// polynomial hashes of its bytes, modulo the prime 2^61-1, computed from the hashes of the symbols a rule contains.
+// Different expansions are very unlikely to have the same ContentHash, but it is not a cryptographic hash,
+// and inputs may be chosen to collide, so MergeCompact and the similarity metrics compare the []byte of symbols
+// whose ContentHash is the same before treating them as the same.
+type ContentHash struct {
+	Length int       // the length in bytes of the expansion
+	Sum    [2]uint64 // the polynomial hashes of the expansion
+}
+
+const hashModulus = 1<<61 - 1
+
+// hashBases are the bases of the two polynomial hashes, fixed so that hashes may be compared across grammars.
+var hashBases = [2]uint64{0x1f3a5c9d2b4e6f71 % hashModulus, 0x0c8e4b2d6a1f3e59 % hashModulus}
+
+// contentHasher gives the ContentHash of each symbol of a grammar, with the powers of the bases
+// needed to combine it with the hashes of the symbols which follow it.
+type contentHasher struct {
+	comp   *Compact
+	hashes map[SymbolID]ContentHash
+	powers map[SymbolID][2]uint64
+}
+
+func newContentHasher(comp *Compact) *contentHasher {
+	return &contentHasher{
+		comp:   comp,
+		hashes: make(map[SymbolID]ContentHash),
+		powers: make(map[SymbolID][2]uint64),
+	}
+}
+
+// hash computes the ContentHash of a symbol, bottom-up from the symbols it contains.
+func (ch *contentHasher) hash(sid SymbolID) (ContentHash, [2]uint64) {
+	if h, done := ch.hashes[sid]; done {
+		return h, ch.powers[sid]
+	}
+	h, pow := ContentHash{}, [2]uint64{1, 1}
+	if sid.IsRule() {
+		for _, child := range ch.comp.Map[sid].IDs {
+			ch2, pow2 := ch.hash(child)
+			h.Length += ch2.Length
+			for i := range h.Sum {
+				h.Sum[i] = addMod(mulMod(h.Sum[i], pow2[i]), ch2.Sum[i])
+				pow[i] = mulMod(pow[i], pow2[i])
+			}
+		}
+	} else {
+		for _, b := range runeOrByte(sid).appendBytes(make([]byte, 0, utf8.UTFMax)) {
+			h.Length++
+			for i := range h.Sum {
+				h.Sum[i] = addMod(mulMod(h.Sum[i], hashBases[i]), uint64(b)+1)
+				pow[i] = mulMod(pow[i], hashBases[i])
+			}
+		}
+	}
+	ch.hashes[sid], ch.powers[sid] = h, pow
+	return h, pow
+}
+
+// Hash gives the ContentHash of a SymbolID, a rule of the grammar or a terminal symbol. It hashes every rule
+// the symbol contains on each call, so Hashes, or the Hash of the indexed grammar, hashes many symbols faster.
+func (comp *Compact) Hash(sid SymbolID) ContentHash {
+	if comp == nil || sid == EmptySymbolID {
+		return ContentHash{}
+	}
+	h, _ := newContentHasher(comp).hash(sid)
+	return h
+}
+
+// Hash gives the ContentHash of a SymbolID, as Compact.Hash does, but from the hashes of the rules computed by Index.
+func (ci *CompactIndexed) Hash(sid SymbolID) ContentHash {
+	if ci == nil {
+		return ContentHash{}
+	}
+	if h, found := ci.symbolHashes()[sid]; found {
+		return h
+	}
+	return ci.CompactBasis.Hash(sid)
+}
+
+// Hashes gives the ContentHash of every rule of the grammar, computing the hash of each symbol only once.
+func (comp *Compact) Hashes() map[SymbolID]ContentHash {
+	ret := make(map[SymbolID]ContentHash)
+	if comp == nil {
+		return ret
+	}
+	ch := newContentHasher(comp)
+	for sid := range comp.Map {
+		ret[sid], _ = ch.hash(sid)
+	}
+	return ret
+}
+
+// ByHash finds the symbol of the indexed grammar with the given ContentHash, as StringToID does for its []byte,
+// which is very likely to be the one sought.
+func (ci *CompactIndexed) ByHash(h ContentHash) (SymbolID, bool) {
+	if ci == nil {
+		return EmptySymbolID, false
+	}
+	if sid, found := ci.hashIndex()[h]; found {
+		return sid, true
+	}
+	return EmptySymbolID, false
+}
+
+func mulMod(a, b uint64) uint64 {
+	hi, lo := bits.Mul64(a, b)
+	// hi*2^64 + lo = hi*8*2^61 + lo, and 2^61 = 1 modulo 2^61-1
+	return addMod((hi<<3)|(lo>>61), lo&hashModulus)
+}
+
+func addMod(a, b uint64) uint64 {
+	s := a + b
+	if s >= hashModulus {
+		s -= hashModulus
+	}
+	return s
+}
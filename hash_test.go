@@ -0,0 +1,56 @@
+package sequitur
+
+import (
+	"fmt"
+	"testing"
+)
+
+func ExampleCompact_Hash() {
+
+	comp := Parse([]byte(testCompact)).Compact()
+	ci2 := RePair([]byte(testCompact)).Index(nil)
+
+	for _, sid := range comp.topologicalOrder() {
+		if sid2, found := ci2.ByHash(comp.Hash(sid)); found {
+			fmt.Printf("%d %q %d\n", sid, comp.Bytes(sid), sid2)
+		}
+	}
+
+	// Output:
+	// 1114369 "Round and round the ragged rocks, the ragged rascal ran." 1114369
+	// 1114387 " ra" 1114371
+}
+
+func TestHashes(t *testing.T) {
+	files, ins := testFiles(t)
+	for f, in := range ins {
+		file := files[f]
+		byString := make(map[string]ContentHash)
+		byHash := make(map[ContentHash]string)
+		for _, inferrer := range []Inferrer{Sequitur, InferrerFunc(RePair), InferrerFunc(LZ78)} {
+			comp := inferrer.Infer(in)
+			for sid, h := range comp.Hashes() {
+				str := string(comp.Bytes(sid))
+				if h.Length != len(str) || h != comp.Hash(sid) {
+					t.Fatalf("%s: hash %v of %q", file, h, str)
+				}
+				if h2, found := byString[str]; found && h2 != h {
+					t.Fatalf("%s: %q has hashes %v and %v", file, str, h, h2)
+				}
+				if str2, found := byHash[h]; found && str2 != str {
+					t.Fatalf("%s: %q and %q have hash %v", file, str, str2, h)
+				}
+				byString[str], byHash[h] = h, str
+			}
+			ci := comp.Index(nil)
+			if len(ci.HashToID) != len(ci.StringToID) {
+				t.Errorf("%s: %d hashes for %d strings", file, len(ci.HashToID), len(ci.StringToID))
+			}
+			for str, sid := range ci.StringToID {
+				if sid2, found := ci.ByHash(ci.Hash(sid)); !found || sid2 != sid || ci.Hash(sid) != comp.Hash(sid) {
+					t.Errorf("%s: ByHash of %q gave %v", file, str, sid2)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,490 @@
+package sequitur
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// Inferrer infers a straight-line grammar for its input, which is the only grammar whose expansion is that input.
+// The analysis of a grammar, from Compact.Index onwards, does not depend on the algorithm used to infer it,
+// so Inferrers may be compared by the rules they find. Functions such as RePair may be used as an Inferrer
+// by converting them to an InferrerFunc.
+type Inferrer interface {
+	Infer(str []byte) *Compact
+}
+
+// InferrerFunc allows an ordinary function to be used as an Inferrer.
+type InferrerFunc func(str []byte) *Compact
+
+// Infer calls f(str).
+func (f InferrerFunc) Infer(str []byte) *Compact {
+	return f(str)
+}
+
+// Sequitur infers a grammar using Parse.
+var Sequitur Inferrer = InferrerFunc(func(str []byte) *Compact { return Parse(str).Compact() })
+
+// LZ78 builds a grammar from the LZ78 parse of the given bytes, in which each phrase is the longest previous phrase
+// which matches the input, followed by one more symbol. A phrase of more than one symbol is a rule made of
+// the rule or terminal symbol for the previous phrase and that symbol, and the root is the sequence of phrases.
+// Rules used only once are expanded where they are used. LZ78 is fast, but finds far fewer useful rules than Parse.
+func LZ78(str []byte) *Compact {
+	var seq SymbolIDslice
+	eachRuneOrByte(str, func(rb runeOrByte) {
+		seq = append(seq, SymbolID(rb))
+	})
+	if len(seq) == 0 {
+		return emptyCompact()
+	}
+
+	rootID := SymbolID(rootRuleID)
+	nextID := rootID
+	bodies := make(map[SymbolID]SymbolIDslice)
+	phrases := make(map[pair]SymbolID) // the rule for each phrase of more than one symbol
+	var root SymbolIDslice
+	for i := 0; i < len(seq); {
+		phrase := seq[i]
+		for i++; i < len(seq); i++ {
+			longer, found := phrases[pair{phrase, seq[i]}]
+			if !found {
+				break
+			}
+			phrase = longer
+		}
+		if i < len(seq) { // a new phrase
+			nextID++
+			bodies[nextID] = SymbolIDslice{phrase, seq[i]}
+			phrases[pair{phrase, seq[i]}] = nextID
+			phrase = nextID
+			i++
+		}
+		root = append(root, phrase)
+	}
+	bodies[rootID] = root
+	return compactFromBodies(rootID, bodies)
+}
+
+// LongestFirst builds a grammar for the given bytes by repeatedly replacing the longest sequence of symbols which
+// occurs at least twice, without overlapping, in the rules so far by a new rule. Ties are broken by the order of
+// the sequences, so the result is deterministic. Rules left with only one use are expanded where they are used.
+// The suffixes of the rules are sorted once for each round of replacements, rather than for each, so a sequence
+// which contains the rules made by a round is only found by the next, even if it is longer than the rest of
+// the sequences replaced by that round.
+func LongestFirst(str []byte) *Compact {
+	var root SymbolIDslice
+	eachRuneOrByte(str, func(rb runeOrByte) {
+		root = append(root, SymbolID(rb))
+	})
+	if len(root) == 0 {
+		return emptyCompact()
+	}
+
+	rootID := SymbolID(rootRuleID)
+	nextID := rootID
+	bodies := map[SymbolID]SymbolIDslice{rootID: root}
+	replaceRepeats(bodies, SymbolIDslice{rootID}, rootID, nextID, 2)
+	return compactFromBodies(rootID, bodies)
+}
+
+// replaceRepeats replaces the sequences of at least minLength symbols which occur at least twice without overlapping
+// in the rules, taken in the given order, by new rules, longest first, giving the largest ID of the rules.
+// A sequence which is the contents of a rule other than the root is replaced by that rule.
+// Each round sorts the suffixes of all of the rules once, then replaces the repeats it finds, longest first,
+// at the occurrences which earlier replacements have left intact, so the repeats which contain the new rules,
+// which are rarely longer than those found by the same round, are found by the next round.
+func replaceRepeats(bodies map[SymbolID]SymbolIDslice, order SymbolIDslice, rootID, nextID SymbolID,
+	minLength int) SymbolID {
+	for {
+		rs := newRepeats(bodies, order)
+		var replaced bool
+		replaced, nextID = rs.replace(rootID, nextID, minLength)
+		if !replaced {
+			return nextID
+		}
+		for sid := range rs.rules {
+			bodies[sid] = rs.body(sid)
+		}
+		order = sortedIDs(bodies)
+	}
+}
+
+// repeats holds the rules for a round of replaceRepeats as linked lists over seq, which starts with the symbols
+// of each rule at the start of the round, each followed by a separator, then has the uses of the new rules.
+type repeats struct {
+	seq        SymbolIDslice
+	prev, next []int             // the neighbouring symbols in the same rule, or -1 at the ends
+	owner      SymbolIDslice     // the rule each symbol is in
+	removed    []bool            // the symbols replaced by a use of a rule
+	starts     map[SymbolID]int  // the first symbol of each rule
+	size       int               // the number of symbols at the start of the round
+	broken     fenwick           // 1 for each symbol at the start of the round which is not followed by the next
+	suffixes   []int             // the suffixes at the start of the round, in order
+	lcp        []int             // the length of the prefix each suffix shares with the previous one
+	queue      repeatQueue       // the repeats found, longest first
+	rules      map[SymbolID]bool // the rules, as they may be used for their contents
+}
+
+func newRepeats(bodies map[SymbolID]SymbolIDslice, order SymbolIDslice) *repeats {
+	rs := &repeats{starts: make(map[SymbolID]int), rules: make(map[SymbolID]bool)}
+	for k, sid := range order {
+		rs.rules[sid] = true
+		rs.starts[sid] = len(rs.seq)
+		for i, s := range bodies[sid] {
+			rs.add(s, sid, len(rs.seq)-1, len(rs.seq)+1)
+			if i == 0 {
+				rs.prev[len(rs.seq)-1] = -1
+			}
+		}
+		if len(bodies[sid]) > 0 {
+			rs.next[len(rs.seq)-1] = -1
+		}
+		rs.add(SymbolID(EmptySymbolID-1-k), EmptySymbolID, -1, -1) // unique, so no repeat spans two rules
+		rs.removed[len(rs.seq)-1] = true
+	}
+	rs.size = len(rs.seq)
+	rs.broken = make(fenwick, rs.size+1)
+	for i := 0; i < rs.size; i++ {
+		if rs.next[i] != i+1 {
+			rs.broken.add(i)
+		}
+	}
+
+	rs.suffixes, rs.lcp = suffixArray(rs.seq)
+	return rs
+}
+
+// suffixArray gives the suffixes of seq in order, sorted by prefix doubling, with the length of the prefix each
+// shares with the one before, found by Kasai's algorithm.
+func suffixArray(seq SymbolIDslice) (suffixes, lcp []int) {
+	n := len(seq)
+	suffixes = make([]int, n)
+	rank := make([]int, n)
+	for i := range suffixes {
+		suffixes[i] = i
+	}
+	sort.Slice(suffixes, func(i, j int) bool { return seq[suffixes[i]] < seq[suffixes[j]] })
+	for k := 1; k < n; k++ {
+		rank[suffixes[k]] = rank[suffixes[k-1]]
+		if seq[suffixes[k]] != seq[suffixes[k-1]] {
+			rank[suffixes[k]]++
+		}
+	}
+	next := make([]int, n)
+	for h := 1; n > 0 && rank[suffixes[n-1]] < n-1; h *= 2 {
+		// the rank of the symbols h after each suffix, or -1 past the end
+		after := func(i int) int {
+			if i+h < n {
+				return rank[i+h]
+			}
+			return -1
+		}
+		sort.Slice(suffixes, func(i, j int) bool {
+			a, b := suffixes[i], suffixes[j]
+			if rank[a] != rank[b] {
+				return rank[a] < rank[b]
+			}
+			return after(a) < after(b)
+		})
+		next[suffixes[0]] = 0
+		for k := 1; k < n; k++ {
+			a, b := suffixes[k-1], suffixes[k]
+			next[b] = next[a]
+			if rank[a] != rank[b] || after(a) != after(b) {
+				next[b]++
+			}
+		}
+		rank, next = next, rank
+	}
+
+	lcp = make([]int, n)
+	for k, i := range suffixes {
+		rank[i] = k
+	}
+	length := 0
+	for i := 0; i < n; i++ {
+		if rank[i] == 0 {
+			length = 0
+			continue
+		}
+		j := suffixes[rank[i]-1]
+		for i+length < n && j+length < n && seq[i+length] == seq[j+length] {
+			length++
+		}
+		lcp[rank[i]] = length
+		if length > 0 {
+			length--
+		}
+	}
+	return suffixes, lcp
+}
+
+// add a symbol to the end of seq.
+func (rs *repeats) add(sid, owner SymbolID, prev, next int) {
+	rs.seq = append(rs.seq, sid)
+	rs.owner = append(rs.owner, owner)
+	rs.prev = append(rs.prev, prev)
+	rs.next = append(rs.next, next)
+	rs.removed = append(rs.removed, false)
+}
+
+// replace the repeats of at least minLength symbols found by sorting the suffixes, longest first,
+// saying if any were replaced, and giving the largest ID of the rules.
+func (rs *repeats) replace(rootID, nextID SymbolID, minLength int) (bool, SymbolID) {
+	// each interval of suffixes sharing a prefix longer than those they share with the suffixes around them,
+	// with the first and last of their positions, as they can only occur twice without overlapping if those do not
+	type open struct{ length, first, lo, hi int }
+	stack := []open{{0, 0, rs.size, -1}}
+	for k := 1; k <= rs.size; k++ {
+		length := 0
+		if k < rs.size {
+			length = rs.lcp[k]
+		}
+		first, lo, hi := k-1, rs.suffixes[k-1], rs.suffixes[k-1]
+		for length < stack[len(stack)-1].length {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if top.lo < lo {
+				lo = top.lo
+			}
+			if top.hi > hi {
+				hi = top.hi
+			}
+			if top.length >= minLength && hi-lo >= top.length {
+				heap.Push(&rs.queue, repeatSuffixes{top.length, top.first, k - 1})
+			}
+			first = top.first
+		}
+		if top := &stack[len(stack)-1]; length > top.length {
+			stack = append(stack, open{length, first, lo, hi})
+		} else {
+			if lo < top.lo {
+				top.lo = lo
+			}
+			if hi > top.hi {
+				top.hi = hi
+			}
+		}
+	}
+
+	// the suffixes looked at, after which the rest of the repeats are left to the next round, which finds them
+	// in a smaller grammar, so that runs of the same symbols, in which many repeats share each suffix, take
+	// time in proportion to their length
+	work := 0
+	replaced := false
+	for rs.queue.Len() > 0 && (!replaced || work < 4*rs.size) {
+		r := heap.Pop(&rs.queue).(repeatSuffixes)
+		work += r.last - r.first + 1
+		var found []int
+		for k := r.first; k <= r.last; k++ {
+			if i := rs.suffixes[k]; !rs.removed[i+r.length-1] && rs.broken.sum(i, i+r.length-1) == 0 {
+				found = append(found, i)
+			}
+		}
+		sort.Ints(found)
+		uses := found[:0:0]
+		for _, i := range found {
+			if len(uses) == 0 || i >= uses[len(uses)-1]+r.length {
+				uses = append(uses, i)
+			}
+		}
+		if len(uses) < 2 {
+			if len(found) >= 2 && found[len(found)-1]-found[0] >= minLength {
+				// occurrences which overlap, as in a run of the same symbols, of which a shorter prefix does not
+				heap.Push(&rs.queue, repeatSuffixes{found[len(found)-1] - found[0], r.first, r.last})
+			}
+			continue
+		}
+
+		var rule SymbolID = EmptySymbolID
+		for k, i := range uses {
+			if end := i + r.length - 1; rs.prev[i] == -1 && rs.next[end] == -1 && rs.owner[i] != rootID {
+				rule = rs.owner[i] // the contents of the rule
+				uses = append(uses[:k], uses[k+1:]...)
+				break
+			}
+		}
+		if rule == EmptySymbolID {
+			nextID++
+			rule = nextID
+			rs.cut(uses[0], r.length, rule)
+			uses = uses[1:]
+		}
+		for _, i := range uses {
+			rs.use(i, r.length, rule)
+		}
+		replaced = true
+	}
+	return replaced, nextID
+}
+
+// cut the occurrence of a repeat at i out of its rule to make the contents of a new rule, used in its place.
+func (rs *repeats) cut(i, length int, rule SymbolID) {
+	end := i + length - 1
+	rs.link(i, end, rule)
+	rs.prev[i], rs.next[end] = -1, -1
+	rs.broken.add(end)
+	for j := i; j <= end; j++ {
+		rs.owner[j] = rule
+	}
+	rs.starts[rule], rs.rules[rule] = i, true
+}
+
+// use the rule in place of the occurrence of its contents at i.
+func (rs *repeats) use(i, length int, rule SymbolID) {
+	end := i + length - 1
+	rs.link(i, end, rule)
+	for j := i; j <= end; j++ {
+		rs.removed[j] = true
+		rs.broken.add(j)
+	}
+}
+
+// link a use of the rule in place of the symbols from i to end.
+func (rs *repeats) link(i, end int, rule SymbolID) {
+	owner := rs.owner[i]
+	use := len(rs.seq)
+	rs.add(rule, owner, rs.prev[i], rs.next[end])
+	if rs.prev[i] >= 0 {
+		rs.next[rs.prev[i]] = use
+		rs.broken.add(rs.prev[i])
+	} else {
+		rs.starts[owner] = use
+	}
+	if rs.next[end] >= 0 {
+		rs.prev[rs.next[end]] = use
+	}
+}
+
+// body gives the symbols of a rule.
+func (rs *repeats) body(sid SymbolID) SymbolIDslice {
+	var ret SymbolIDslice
+	for i := rs.starts[sid]; i >= 0; i = rs.next[i] {
+		ret = append(ret, rs.seq[i])
+	}
+	return ret
+}
+
+// repeatSuffixes is an entry in a repeatQueue: the suffixes from first to last, in order, share a prefix
+// of the given length.
+type repeatSuffixes struct {
+	length, first, last int
+}
+
+// repeatQueue is a heap of repeats, the longest first, then in the order of their suffixes.
+type repeatQueue []repeatSuffixes
+
+func (q repeatQueue) Len() int { return len(q) }
+func (q repeatQueue) Less(i, j int) bool {
+	if q[i].length != q[j].length {
+		return q[i].length > q[j].length
+	}
+	return q[i].first < q[j].first
+}
+func (q repeatQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *repeatQueue) Push(x interface{}) { *q = append(*q, x.(repeatSuffixes)) }
+func (q *repeatQueue) Pop() interface{} {
+	old := *q
+	x := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return x
+}
+
+// fenwick is a Fenwick tree, counting the marks at each index, and giving the number in a range of indexes.
+type fenwick []int
+
+// add a mark at index i.
+func (f fenwick) add(i int) {
+	for i++; i < len(f); i += i & -i {
+		f[i]++
+	}
+}
+
+// sum gives the number of marks at the indexes from i up to, but not including, j.
+func (f fenwick) sum(i, j int) int {
+	return f.prefix(j) - f.prefix(i)
+}
+
+func (f fenwick) prefix(i int) int {
+	n := 0
+	for ; i > 0; i -= i & -i {
+		n += f[i]
+	}
+	return n
+}
+
+// sortedIDs gives the IDs of the rules in ascending order, as they were created.
+func sortedIDs(bodies map[SymbolID]SymbolIDslice) SymbolIDslice {
+	ret := make(SymbolIDslice, 0, len(bodies))
+	for sid := range bodies {
+		ret = append(ret, sid)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i] < ret[j] })
+	return ret
+}
+
+// bodiesSize gives the number of symbols in the rules, as Compact.Size does.
+func bodiesSize(bodies map[SymbolID]SymbolIDslice) int {
+	size := 0
+	for _, body := range bodies {
+		size += len(body)
+	}
+	return size
+}
+
+// emptyCompact is the Compact form of an empty grammar.
+func emptyCompact() *Compact {
+	return &Compact{
+		RootID: EmptySymbolID,
+		Map:    make(map[SymbolID]CompactEntry),
+	}
+}
+
+// compactFromBodies gives the Compact form of a grammar given the bodies of its rules, expanding the rules which
+// are used only once where they are used.
+func compactFromBodies(rootID SymbolID, bodies map[SymbolID]SymbolIDslice) *Compact {
+	used := references(bodies)
+	var expand func(body SymbolIDslice) SymbolIDslice
+	expand = func(body SymbolIDslice) SymbolIDslice {
+		var ret SymbolIDslice
+		for _, sid := range body {
+			if sid.IsRule() && used[sid] == 1 {
+				ret = append(ret, expand(bodies[sid])...)
+			} else {
+				ret = append(ret, sid)
+			}
+		}
+		return ret
+	}
+	ret := &Compact{
+		RootID: rootID,
+		Map:    make(map[SymbolID]CompactEntry),
+	}
+	var add func(id SymbolID)
+	add = func(id SymbolID) {
+		if _, done := ret.Map[id]; done {
+			return
+		}
+		entry := CompactEntry{Used: used[id], IDs: expand(bodies[id])}
+		ret.Map[id] = entry
+		for _, sid := range entry.IDs {
+			if sid.IsRule() {
+				add(sid)
+			}
+		}
+	}
+	add(rootID)
+	return ret
+}
+
+// references counts the references to each rule from the bodies of the rules.
+func references(bodies map[SymbolID]SymbolIDslice) map[SymbolID]int {
+	ret := make(map[SymbolID]int)
+	for _, body := range bodies {
+		for _, sid := range body {
+			if sid.IsRule() {
+				ret[sid]++
+			}
+		}
+	}
+	return ret
+}
@@ -0,0 +1,73 @@
+package sequitur
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func ExampleInferrer() {
+
+	names := []string{"Sequitur", "RePair", "LZ78", "LongestFirst"}
+	for i, inferrer := range []Inferrer{Sequitur, InferrerFunc(RePair), InferrerFunc(LZ78), InferrerFunc(LongestFirst)} {
+		comp := inferrer.Infer([]byte(testCompact))
+		fmt.Printf("%s: size %d, %d rules\n", names[i], comp.Size(), len(comp.Map))
+	}
+
+	// Output:
+	// Sequitur: size 41, 6 rules
+	// RePair: size 41, 6 rules
+	// LZ78: size 54, 6 rules
+	// LongestFirst: size 41, 6 rules
+}
+
+func ExampleLongestFirst() {
+
+	comp := LongestFirst([]byte(testCompact))
+
+	var output bytes.Buffer
+	if err := comp.PrettyPrint(&output); err != nil {
+		panic(err)
+	}
+
+	fmt.Println(string(output.Bytes()))
+
+	// Output:
+	// 1114369 -> {0 [R 1114374   a n 1114372 1114374 1114370 o c k s , 1114370 a s c a l 1114371 n .]}
+	// 1114370 -> {2 [  t h e 1114371 g g e 1114372]}
+	// 1114371 -> {2 [1114373 a]}
+	// 1114372 -> {2 [d 1114373]}
+	// 1114373 -> {2 [  r]}
+	// 1114374 -> {2 [o u n d]}
+}
+
+// TestInferrers checks the Inferrers other than RePair, which TestRePair checks.
+func TestInferrers(t *testing.T) {
+	inferrers := map[string]Inferrer{
+		"Sequitur":     Sequitur,
+		"LZ78":         InferrerFunc(LZ78),
+		"LongestFirst": InferrerFunc(LongestFirst),
+	}
+	check := func(name string, in []byte) {
+		comp := inferrers[name].Infer(in)
+		if len(in) == 0 && (comp.RootID != EmptySymbolID || len(comp.Map) != 0) {
+			t.Fatalf("%s: empty input gave %v", name, comp)
+		}
+		if err := checkInferred(comp, in); err != nil {
+			t.Fatalf("%s: %q: %v, in\n%v", name, in, err, comp)
+		}
+	}
+
+	_, ins := testFiles(t)
+	rnd := rand.New(rand.NewSource(1))
+	for name := range inferrers {
+		check(name, nil)
+		for i := 0; i < 100; i++ {
+			check(name, randomInput(rnd, i, 500, "abc\xff"))
+		}
+		for _, in := range ins {
+			check(name, in)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package sequitur
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"testing"
+)
+
+// checkInvariants verifies the structure of a Grammar: that rule counts match the references to each rule,
+// that every rule is used at least twice, unless it is from a dictionary, and has at least two symbols (rule utility),
+// that no digram occurs twice, or K times (digram uniqueness), that the digram table only refers to live symbols,
+// and that the uses of each rule are linked, if they are tracked.
+func checkInvariants(g *Grammar) error {
+	if g.base == nil {
+		return nil
+	}
+	refs := make(map[*rules]int)
+	seen := map[*rules]bool{g.base: true}
+	queue := []*rules{g.base}
+	live := make(map[*symbols]*rules)
+	digramAt := make(map[digram]*symbols)
+	occurrences := make(map[digram]int) // if K > 2
+	for len(queue) > 0 {
+		r := queue[0]
+		queue = queue[1:]
+		n := 0
+		for p := r.first(); !p.isGuard(); p = p.next {
+			n++
+			if p.next.prev != p {
+				return fmt.Errorf("rule %d: broken links", r.id)
+			}
+			live[p] = r
+			if p.isNonTerminal() {
+				refs[p.rule]++
+				if !seen[p.rule] {
+					seen[p.rule] = true
+					queue = append(queue, p.rule)
+				}
+			}
+			if p.next.isGuard() || p.spansBarrier() {
+				continue
+			}
+			d := digram{p.value, p.next.value}
+			if g.k > 2 {
+				if last := digramAt[d]; last == nil || !last.overlaps(p) {
+					occurrences[d]++
+					digramAt[d] = p
+				}
+				continue
+			}
+			if other, dup := digramAt[d]; dup && other.next != p && p.next != other {
+				return fmt.Errorf("digram %v repeated in rules %d and %d", d, live[other].id, r.id)
+			}
+			digramAt[d] = p
+		}
+		if r != g.base && n < 2 {
+			return fmt.Errorf("rule %d has %d symbols", r.id, n)
+		}
+	}
+	for r, n := range refs {
+		if r.count != n {
+			return fmt.Errorf("rule %d: count %d, referenced %d times", r.id, r.count, n)
+		}
+		if g.uses != nil {
+			linked := 0
+			for u := r.uses; u != nil && linked <= n; u = g.uses.next(u) {
+				if live[u] == nil || u.rule != r {
+					return fmt.Errorf("rule %d: linked to a symbol which is not a use", r.id)
+				}
+				linked++
+			}
+			if linked != n {
+				return fmt.Errorf("rule %d: %d uses linked, referenced %d times", r.id, linked, n)
+			}
+		}
+		if n < 2 && !r.dictionary {
+			return fmt.Errorf("rule %d only used %d times", r.id, n)
+		}
+	}
+	for d, s := range g.table {
+		if _, ok := live[s]; !ok {
+			return fmt.Errorf("digram %v refers to a deleted symbol", d)
+		}
+		if s.next.isGuard() || (digram{s.value, s.next.value}) != d {
+			return fmt.Errorf("digram %v refers to a symbol with a different digram", d)
+		}
+	}
+	for d, n := range occurrences {
+		if n >= g.k {
+			return fmt.Errorf("digram %v occurs %d times", d, n)
+		}
+	}
+	for d, occ := range g.waiting {
+		for _, o := range occ {
+			if _, isLive := live[o]; !isLive || o.next.isGuard() || (digram{o.value, o.next.value}) != d {
+				return fmt.Errorf("digram %v is waiting at a deleted symbol", d)
+			}
+		}
+	}
+	for d := range digramAt {
+		_, ok := g.table[d]
+		for _, o := range g.waiting[d] {
+			_, isLive := live[o]
+			ok = ok || (isLive && !o.next.isGuard() && (digram{o.value, o.next.value}) == d)
+		}
+		if !ok {
+			return fmt.Errorf("digram %v is missing from the table", d)
+		}
+	}
+	return nil
+}
+
+// checkUsed verifies the Used count of every rule of a Compact grammar but the root: that it matches the references
+// to the rule, and is at least minUsed.
+func checkUsed(comp *Compact, minUsed int) error {
+	refs := make(map[SymbolID]int)
+	for _, entry := range comp.Map {
+		for _, sid := range entry.IDs {
+			if sid.IsRule() {
+				refs[sid]++
+			}
+		}
+	}
+	for sid, entry := range comp.Map {
+		if sid != comp.RootID && (entry.Used != refs[sid] || entry.Used < minUsed) {
+			return fmt.Errorf("rule %v used %d times, referenced %d times", sid, entry.Used, refs[sid])
+		}
+	}
+	return nil
+}
+
+// checkInferred verifies a grammar built by an Inferrer: that it expands to the input, and that every rule but the root
+// is used at least twice, and has at least two symbols.
+func checkInferred(comp *Compact, in []byte) error {
+	if got := comp.Bytes(comp.RootID); !bytes.Equal(got, in) {
+		return fmt.Errorf("expanded to %q", got)
+	}
+	if err := checkUsed(comp, 2); err != nil {
+		return err
+	}
+	for sid, entry := range comp.Map {
+		if sid != comp.RootID && len(entry.IDs) < 2 {
+			return fmt.Errorf("rule %v has %d symbols", sid, len(entry.IDs))
+		}
+	}
+	return nil
+}
+
+// randomInput gives the ith of a series of random inputs of less than maxLen bytes, drawn from the first byte of the
+// alphabet, then the first two, and so on, so that the inputs range from one repeated byte to the whole alphabet.
+func randomInput(rnd *rand.Rand, i, maxLen int, alphabet string) []byte {
+	in := make([]byte, rnd.Intn(maxLen))
+	for j := range in {
+		in[j] = alphabet[rnd.Intn(1+i%len(alphabet))]
+	}
+	return in
+}
+
+// testFiles reads the inputs in testdata, and importance_test.go as a larger input, giving their names and contents.
+func testFiles(t *testing.T) ([]string, [][]byte) {
+	files, err := filepath.Glob("testdata/*.input")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files = append(files, "importance_test.go")
+	ins := make([][]byte, len(files))
+	for i, file := range files {
+		if ins[i], err = ioutil.ReadFile(file); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return files, ins
+}
@@ -0,0 +1,139 @@
+package sequitur
+
+// waiting holds the occurrences of each digram, other than the one in the digram table, which have not yet
+// occurred K times. An occurrence is forgotten when its digram is deleted, as its symbols leave the window or
+// its rule is expanded or removed, so that only the digrams of the current grammar are held.
+type waiting map[digram][]*symbols
+
+// forget removes the occurrence at s of its digram, which is being deleted, and the digram once it has none.
+func (w waiting) forget(s *symbols) {
+	d := digram{s.value, s.next.value}
+	occ := w[d]
+	for i, o := range occ {
+		if o == s {
+			occ = append(occ[:i], occ[i+1:]...)
+			break
+		}
+	}
+	if len(occ) == 0 {
+		delete(w, d)
+	} else {
+		w[d] = occ
+	}
+}
+
+// current gives the occurrences of the digram which are still in place and do not overlap x, or each other.
+func (w waiting) current(d digram, x *symbols) []*symbols {
+	var ret []*symbols
+	for _, o := range w[d] {
+		if !o.inUse() || o.next.isGuard() || (digram{o.value, o.next.value}) != d || (x != nil && o.overlaps(x)) {
+			continue
+		}
+		overlapping := false
+		for _, p := range ret {
+			overlapping = overlapping || o.overlaps(p)
+		}
+		if !overlapping {
+			ret = append(ret, o)
+		}
+	}
+	return ret
+}
+
+// promote the first current occurrence of the digram at s into the digram table, once the one there is deleted.
+func (w waiting) promote(s *symbols) (*symbols, bool) {
+	d := digram{s.value, s.next.value}
+	occ := w.current(d, nil)
+	if len(occ) == 0 {
+		delete(w, d)
+		return nil, false
+	}
+	w[d] = occ[1:]
+	s.g.table.insert(occ[0])
+	return occ[0], true
+}
+
+// wait records s as another occurrence of the digram at x, which is in the digram table, until there are K of them,
+// when they are all replaced by a rule.
+func (s *symbols) wait(x *symbols) bool {
+	d := digram{s.value, s.next.value}
+	occ := append([]*symbols{x}, s.g.waiting.current(d, x)...)
+	counted := false
+	for _, o := range occ {
+		counted = counted || o.overlaps(s)
+	}
+	if !counted {
+		occ = append(occ, s)
+	}
+	if d.one == d.two {
+		occ = runs(occ)
+	}
+	if len(occ) < s.g.k {
+		s.g.waiting[d] = occ
+		return false
+	}
+	delete(s.g.waiting, d)
+	s.matchAll(occ)
+	return true
+}
+
+// runs gives the occurrences of a digram of two of the same symbol which do not overlap, taken from the start of
+// each run of that symbol containing one of the given occurrences, as the given ones may overlap the others.
+func runs(occ []*symbols) []*symbols {
+	var ret []*symbols
+	seen := make(map[*symbols]bool)
+	for _, o := range occ {
+		for !o.prev.isGuard() && o.prev.value == o.value {
+			o = o.prev
+		}
+		if seen[o] {
+			continue
+		}
+		seen[o] = true
+		for p := o; !p.isGuard() && !p.next.isGuard() && p.value == o.value && p.next.value == o.value; p = p.next.next {
+			ret = append(ret, p)
+		}
+	}
+	return ret
+}
+
+// matchAll replaces the occurrences of a digram by a rule, which is new unless one of them is the whole of a rule.
+// An occurrence may be changed by the checks which follow replacing another, and is then left alone.
+func (s *symbols) matchAll(occ []*symbols) {
+	d := digram{s.value, s.next.value}
+	var r *rules
+	for _, o := range occ {
+		if o.isWholeRule() {
+			r = o.prev.rule
+			break
+		}
+	}
+	created := r == nil
+	if created {
+		r = s.g.newRules()
+		r.last().insertAfter(s.g.newSymbol(s))
+		r.last().insertAfter(s.g.newSymbol(s.next))
+	}
+
+	r.count++ // held, so that the checks cannot expand r until every occurrence is replaced
+	for _, o := range occ {
+		if !o.inUse() || o.next.isGuard() || (digram{o.value, o.next.value}) != d {
+			continue
+		}
+		switch {
+		case o == r.first():
+		case o.isWholeRule():
+			s.g.replaceRule(o.prev.rule, r)
+		default:
+			o.substitute(r)
+		}
+	}
+	if r.first().inUse() {
+		s.g.table.insert(r.first())
+	}
+	r.count--
+	r.enforceUtility()
+	if r.count < 2 { // some of its uses were absorbed by the checks
+		s.g.reduce(r)
+	}
+}
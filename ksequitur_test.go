@@ -0,0 +1,84 @@
+package sequitur
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func ExampleOptions_k() {
+
+	g := ParseWithOptions([]byte(testString[:strings.Index(testString, "《")]), Options{K: 3})
+
+	var output bytes.Buffer
+	if err := g.PrettyPrint(&output); err != nil {
+		panic(err)
+	}
+
+	fmt.Println(output.String())
+
+	// Output:
+	// 0 -> 1 h 2 1 c 3 , 1 4 _ t h 5 2 \n n 4 6 d a y s _ 3 . \n 7 h 2 7 c 3 , 7 4 _ t h 5 o t , \n n 4 6 d a y s _ o l d . \n \n
+	// 1 -> \n p e a s 5 o r r i d g 6
+	// 2 -> o t ,
+	// 3 -> o l d
+	// 4 -> i n
+	// 5 -> 6 p
+	// 6 -> e _
+	// 7 -> \n s o m 6 l i k 6 i t _
+}
+
+func TestK(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 600; i++ {
+		in := randomInput(rnd, i, 600, "abc\n")
+		opts := Options{K: 3 + i%3}
+		if i%5 == 0 {
+			opts.Barriers = []rune{'\n'}
+		}
+		if i%7 == 0 {
+			opts.Window = rnd.Intn(100)
+		}
+		g := NewGrammar(opts)
+		for rest := in; len(rest) > 0; {
+			n := rnd.Intn(len(rest) + 1)
+			g.Append(rest[:n])
+			if err := checkInvariants(g); err != nil {
+				t.Fatalf("%d: %+v: %v", i, opts, err)
+			}
+			rest = rest[n:]
+		}
+		if opts.Window > 0 && len(in) > opts.Window {
+			in = in[len(in)-opts.Window:]
+		}
+		var b bytes.Buffer
+		if err := g.Print(&b); err != nil || !bytes.Equal(b.Bytes(), in) {
+			t.Fatalf("%d: %+v: got %q, want %q", i, opts, b.Bytes(), in)
+		}
+	}
+}
+
+func TestKWindow(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	opts := Options{Window: 500, K: 3}
+	g := NewGrammar(opts)
+	in := make([]byte, 1000)
+	for i := 0; i < 200; i++ {
+		for j := range in {
+			in[j] = "abcdefgh"[rnd.Intn(8)]
+		}
+		g.Append(in)
+		waiting := 0
+		for _, occ := range g.waiting {
+			waiting += len(occ)
+		}
+		if len(g.table) > 2*opts.Window || waiting > 2*opts.Window {
+			t.Fatalf("after %d bytes: %d digrams in the table and %d waiting", (i+1)*len(in), len(g.table), waiting)
+		}
+	}
+	if err := checkInvariants(g); err != nil {
+		t.Fatal(err)
+	}
+}
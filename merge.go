@@ -0,0 +1,129 @@
+package sequitur
+
+import (
+	"bytes"
+	"sort"
+)
+
+// MergeCompact merges two grammars into one, so that a rule of b with the same expansion as a rule of a, or as
+// another rule of b, is replaced by that rule. Rules are matched by their ContentHash, then their expansions compared.
+// The root of the result is a new rule whose expansion is the expansion of a followed by the expansion of b,
+// made of the two roots, so that both remain addressable.
+// The rules of a keep their SymbolIDs, the other rules of b are numbered after the largest ID in a,
+// and the root after them. The map gives the SymbolID in the result of each rule of b which remains in it,
+// including its root. Rules of b which are only used by rules found in a are not needed, so are left out.
+// If either grammar is empty, the result is a copy of the other.
+func MergeCompact(a, b *Compact) (*Compact, map[SymbolID]SymbolID) {
+	ids := make(map[SymbolID]SymbolID)
+	if b == nil || b.RootID == EmptySymbolID {
+		if a == nil || a.RootID == EmptySymbolID {
+			return emptyCompact(), ids
+		}
+		return copyCompact(a), ids
+	}
+	if a == nil || a.RootID == EmptySymbolID {
+		for sid := range b.Map {
+			ids[sid] = sid
+		}
+		return copyCompact(b), ids
+	}
+
+	bodies := make(map[SymbolID]SymbolIDslice, len(a.Map)+len(b.Map)+1)
+	byHash := make(map[ContentHash]SymbolID, len(a.Map)+len(b.Map))
+	nextID := SymbolID(rootRuleID - 1)
+	aIDs := make(SymbolIDslice, 0, len(a.Map))
+	for sid := range a.Map {
+		aIDs = append(aIDs, sid)
+	}
+	sort.Slice(aIDs, func(i, j int) bool { return aIDs[i] < aIDs[j] })
+	aHashes := a.Hashes()
+	for _, sid := range aIDs {
+		bodies[sid] = append(SymbolIDslice{}, a.Map[sid].IDs...)
+		if _, found := byHash[aHashes[sid]]; !found {
+			byHash[aHashes[sid]] = sid
+		}
+		if sid > nextID {
+			nextID = sid
+		}
+	}
+
+	// the rules of b are visited after the rules they contain, so that a rule is never replaced by a rule it contains
+	order := b.topologicalOrder()
+	bHashes := b.Hashes()
+	fromB := make(map[SymbolID]SymbolID) // the rule of b each new rule was made from
+	expansion := func(id SymbolID) []byte {
+		if from, found := fromB[id]; found {
+			return b.Bytes(from)
+		}
+		return a.Bytes(id)
+	}
+	for i := len(order) - 1; i >= 0; i-- {
+		sid := order[i]
+		id, found := byHash[bHashes[sid]]
+		if found && bytes.Equal(expansion(id), b.Bytes(sid)) {
+			ids[sid] = id
+			continue
+		}
+		nextID++
+		ids[sid] = nextID
+		fromB[nextID] = sid
+		if !found {
+			byHash[bHashes[sid]] = nextID
+		}
+		body := make(SymbolIDslice, len(b.Map[sid].IDs))
+		for k, child := range b.Map[sid].IDs {
+			if child.IsRule() {
+				child = ids[child]
+			}
+			body[k] = child
+		}
+		bodies[nextID] = body
+	}
+
+	nextID++
+	bodies[nextID] = SymbolIDslice{a.RootID, ids[b.RootID]}
+	ret := reachableCompact(nextID, bodies)
+	for sid, id := range ids {
+		if _, found := ret.Map[id]; !found {
+			delete(ids, sid)
+		}
+	}
+	return ret, ids
+}
+
+// copyCompact gives a copy of a grammar which shares nothing with it.
+func copyCompact(comp *Compact) *Compact {
+	ret := &Compact{
+		RootID: comp.RootID,
+		Map:    make(map[SymbolID]CompactEntry, len(comp.Map)),
+	}
+	for sid, entry := range comp.Map {
+		ret.Map[sid] = CompactEntry{Used: entry.Used, IDs: append(SymbolIDslice{}, entry.IDs...)}
+	}
+	return ret
+}
+
+// reachableCompact gives the Compact form of the rules reachable from the root, counting their uses.
+func reachableCompact(rootID SymbolID, bodies map[SymbolID]SymbolIDslice) *Compact {
+	ret := &Compact{
+		RootID: rootID,
+		Map:    make(map[SymbolID]CompactEntry, len(bodies)),
+	}
+	for sid, body := range bodies {
+		ret.Map[sid] = CompactEntry{IDs: body}
+	}
+	order := ret.topologicalOrder()
+	used := make(map[SymbolID]int, len(order))
+	for _, sid := range order {
+		for _, child := range bodies[sid] {
+			if child.IsRule() {
+				used[child]++
+			}
+		}
+	}
+	ret.Map = make(map[SymbolID]CompactEntry, len(order))
+	for _, sid := range order {
+		ret.Map[sid] = CompactEntry{Used: used[sid], IDs: bodies[sid]}
+	}
+	return ret
+}
@@ -0,0 +1,82 @@
+package sequitur
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func ExampleMergeCompact() {
+
+	a := Parse([]byte("the ragged rocks, the ragged rascal")).Compact()
+	b := Parse([]byte("the ragged rascal, the ragged rocks")).Compact()
+	merged, ids := MergeCompact(a, b)
+
+	var output bytes.Buffer
+	if err := merged.PrettyPrint(&output); err != nil {
+		panic(err)
+	}
+	fmt.Print(output.String())
+	fmt.Printf("%q\n", merged.Bytes(ids[b.RootID]))
+
+	// Output:
+	// 1114369 -> {1 [1114379 o c k s ,   1114379 a s c a l]}
+	// 1114370 -> {4 [  r]}
+	// 1114379 -> {2 [t h e 1114370 a g g e d 1114370]}
+	// 1114380 -> {2 [1114370 a]}
+	// 1114381 -> {2 [t h e 1114380 g g e d]}
+	// 1114382 -> {1 [1114381 1114380 s c a l ,   1114381 1114370 o c k s]}
+	// 1114383 -> {0 [1114369 1114382]}
+	// "the ragged rascal, the ragged rocks"
+}
+
+func TestMergeCompact(t *testing.T) {
+	check := func(in, in2 []byte, a, b *Compact) {
+		merged, ids := MergeCompact(a, b)
+		if got := merged.Bytes(merged.RootID); !bytes.Equal(got, append(append([]byte{}, in...), in2...)) {
+			t.Fatalf("merging %q and %q gave %q", in, in2, got)
+		}
+		if len(in2) > 0 && !bytes.Equal(merged.Bytes(ids[b.RootID]), in2) {
+			t.Fatalf("merging %q and %q lost the root of b", in, in2)
+		}
+		for sid, id := range ids {
+			if !bytes.Equal(merged.Bytes(id), b.Bytes(sid)) {
+				t.Fatalf("merging %q and %q mapped %q to %q", in, in2, b.Bytes(sid), merged.Bytes(id))
+			}
+		}
+		if len(in) > 0 {
+			for sid := range merged.Map {
+				if _, found := a.Map[sid]; found && !bytes.Equal(merged.Bytes(sid), a.Bytes(sid)) {
+					t.Fatalf("merging %q and %q changed the rule %q of a", in, in2, a.Bytes(sid))
+				}
+			}
+		}
+		seen := make(map[string]bool)
+		for sid := range merged.Map {
+			str := string(merged.Bytes(sid))
+			if _, found := a.Map[sid]; !found && seen[str] {
+				t.Fatalf("merging %q and %q gave two rules for %q", in, in2, str)
+			}
+			seen[str] = true
+		}
+		if err := checkUsed(merged, 1); err != nil {
+			t.Fatalf("merging %q and %q: %v", in, in2, err)
+		}
+		if size := merged.Size(); len(in) > 0 && len(in2) > 0 && size > a.Size()+b.Size()+2 {
+			t.Errorf("merging %q and %q gave size %d, more than %d and %d", in, in2, size, a.Size(), b.Size())
+		}
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 300; i++ {
+		in := randomInput(rnd, i, 300, "abc")
+		in2 := append(in[rnd.Intn(len(in)+1):], in[:rnd.Intn(len(in)+1)]...)
+		check(in, in2, Parse(in).Compact(), RePair(in2))
+	}
+
+	_, ins := testFiles(t)
+	for i := 1; i < len(ins); i++ {
+		check(ins[i-1], ins[i], Parse(ins[i-1]).Compact(), Parse(ins[i]).Compact())
+	}
+}
@@ -0,0 +1,95 @@
+package sequitur
+
+import "math"
+
+// Size of a Compact grammar: the number of symbols on the right hand side of all of its rules.
+func (comp *Compact) Size() int {
+	if comp == nil {
+		return 0
+	}
+	size := 0
+	for _, entry := range comp.Map {
+		size += len(entry.IDs)
+	}
+	return size
+}
+
+// EntropySize of a Compact grammar in bits: the symbols on the right hand side of all of its rules,
+// as coded by an order-0 entropy coder.
+func (comp *Compact) EntropySize() float64 {
+	if comp == nil {
+		return 0
+	}
+	counts := make(map[SymbolID]int)
+	total := 0
+	for _, entry := range comp.Map {
+		for _, sid := range entry.IDs {
+			counts[sid]++
+		}
+		total += len(entry.IDs)
+	}
+	bits := 0.0
+	for _, n := range counts {
+		bits += float64(n) * math.Log2(float64(total)/float64(n))
+	}
+	return bits
+}
+
+func compactSize(comp *Compact) float64 {
+	return float64(comp.Size())
+}
+
+// GrammarNCD gives the normalized compression distance between a and b, using the Size of their grammars.
+// Result: 0 (or nearby) equality, 1 (or nearby) nothing in common.
+func GrammarNCD(a, b []byte) float64 {
+	return GrammarNCDWith(a, b, nil)
+}
+
+// GrammarNCDWith gives the normalized compression distance between a and b,
+// using the given function to measure the size of their grammars, or Size if it is nil.
+func GrammarNCDWith(a, b []byte, sizeFn func(*Compact) float64) float64 {
+	if sizeFn == nil {
+		sizeFn = compactSize
+	}
+	return ncd(sizeFn(Parse(a).Compact()), sizeFn(Parse(b).Compact()), sizeFn(Parse(concat(a, b)).Compact()))
+}
+
+// GrammarNCDMatrix gives the normalized compression distance between every pair of docs,
+// using the given function to measure the size of their grammars, or Size if it is nil.
+// The result is symmetric, with the distance between docs i and j (i<=j) computed from docs[i] followed by docs[j].
+func GrammarNCDMatrix(docs [][]byte, sizeFn func(*Compact) float64) [][]float64 {
+	if sizeFn == nil {
+		sizeFn = compactSize
+	}
+	sizes := make([]float64, len(docs))
+	for i, doc := range docs {
+		sizes[i] = sizeFn(Parse(doc).Compact())
+	}
+	ret := make([][]float64, len(docs))
+	for i := range ret {
+		ret[i] = make([]float64, len(docs))
+	}
+	for i := range docs {
+		for j := i; j < len(docs); j++ {
+			d := ncd(sizes[i], sizes[j], sizeFn(Parse(concat(docs[i], docs[j])).Compact()))
+			ret[i][j], ret[j][i] = d, d
+		}
+	}
+	return ret
+}
+
+func ncd(sizeA, sizeB, sizeAB float64) float64 {
+	lo, hi := sizeA, sizeB
+	if lo > hi {
+		lo, hi = hi, lo
+	}
+	if hi == 0 {
+		return 0 // two empty inputs are equal
+	}
+	return (sizeAB - lo) / hi
+}
+
+func concat(a, b []byte) []byte {
+	ab := make([]byte, 0, len(a)+len(b))
+	return append(append(ab, a...), b...)
+}
@@ -0,0 +1,52 @@
+package sequitur
+
+import (
+	"fmt"
+	"testing"
+)
+
+func ExampleGrammarNCDMatrix() {
+
+	texts := [][]byte{[]byte(testSimilarity), []byte(testImportance), []byte(testString), nil}
+	textNames := []string{"sequitur.info", "wikipedia", "pease pudding", "empty"}
+
+	for i, row := range GrammarNCDMatrix(texts, nil) {
+		for j, d := range row {
+			fmt.Printf("%7.5f %15s %15s\n", d, textNames[i], textNames[j])
+		}
+	}
+
+	// Output:
+	// 0.08580   sequitur.info   sequitur.info
+	// 0.90179   sequitur.info       wikipedia
+	// 0.98225   sequitur.info   pease pudding
+	// 1.00000   sequitur.info           empty
+	// 0.90179       wikipedia   sequitur.info
+	// 0.19800       wikipedia       wikipedia
+	// 0.99265       wikipedia   pease pudding
+	// 1.00000       wikipedia           empty
+	// 0.98225   pease pudding   sequitur.info
+	// 0.99265   pease pudding       wikipedia
+	// 0.10326   pease pudding   pease pudding
+	// 1.00000   pease pudding           empty
+	// 1.00000           empty   sequitur.info
+	// 1.00000           empty       wikipedia
+	// 1.00000           empty   pease pudding
+	// 0.00000           empty           empty
+}
+
+func TestGrammarNCD(t *testing.T) {
+	a := []byte(testImportance)
+	if d := GrammarNCD(a, a); d > 0.25 {
+		t.Error("distance from itself too large:", d)
+	}
+	if d, d2 := GrammarNCD(a, []byte(testSimilarity)), GrammarNCD(a, []byte(testString)); d > d2 {
+		t.Error("wikipedia closer to pease pudding than to sequitur.info:", d, d2)
+	}
+	if d := GrammarNCD(nil, nil); d != 0 {
+		t.Error("distance between empty inputs not zero:", d)
+	}
+	if d, d2 := GrammarNCDWith(a, a, (*Compact).EntropySize), GrammarNCDWith(a, []byte(testString), (*Compact).EntropySize); d >= d2 {
+		t.Error("entropy size distance from itself not smaller:", d, d2)
+	}
+}
@@ -0,0 +1,249 @@
+package sequitur
+
+import "sort"
+
+// OptimizeOptions select the refinements made by Compact.Optimize. The zero value makes all of them.
+type OptimizeOptions struct {
+	NoInline    bool // keep the rules which do not reduce the size of the grammar
+	NoRebalance bool // do not use a rule where its contents are found within another rule
+	NoExtract   bool // do not extract the repeats missed by Sequitur into new rules
+	MaxPasses   int  // the maximum number of passes over the grammar, or 0 for as many as reduce its size
+}
+
+// Optimize gives a grammar with the same expansion, and no larger, by refining the rules offline.
+// Sequitur reads its input once, from left to right, so it misses repeats which it sees only once it has formed
+// rules which break them up, and keeps rules which are only used twice, or have only two symbols.
+// Each pass of Optimize inlines the rules which do not reduce the size of the grammar, exposing the repeats
+// which they break up, uses each rule wherever its contents are found within another rule, extracts the repeats
+// which would reduce the size of the grammar into new rules, longest first, then inlines again, until a pass
+// makes no improvement. The SymbolIDs of the rules which remain are unchanged, and the IDs of new rules follow
+// the largest ID in the grammar. Repeats are found as LongestFirst finds them, so each pass takes time not much
+// more than in proportion to the size of the grammar.
+func (comp *Compact) Optimize(opts OptimizeOptions) *Compact {
+	if comp == nil {
+		return nil
+	}
+	if comp.RootID == EmptySymbolID {
+		return emptyCompact()
+	}
+	o := &optimizer{
+		rootID: comp.RootID,
+		bodies: make(map[SymbolID]SymbolIDslice, len(comp.Map)),
+	}
+	for sid, entry := range comp.Map {
+		o.bodies[sid] = append(SymbolIDslice{}, entry.IDs...)
+		if sid > o.nextID {
+			o.nextID = sid
+		}
+	}
+	o.removeUnused()
+
+	for pass := 0; opts.MaxPasses == 0 || pass < opts.MaxPasses; pass++ {
+		before := o.size()
+		if !opts.NoInline {
+			o.inline()
+		}
+		if !opts.NoRebalance {
+			o.rebalance()
+		}
+		if !opts.NoExtract {
+			o.extract()
+		}
+		if !opts.NoInline {
+			o.inline()
+		}
+		if o.size() >= before {
+			break
+		}
+	}
+
+	ret := &Compact{
+		RootID: o.rootID,
+		Map:    make(map[SymbolID]CompactEntry, len(o.bodies)),
+	}
+	used := references(o.bodies)
+	for sid, body := range o.bodies {
+		ret.Map[sid] = CompactEntry{Used: used[sid], IDs: body}
+	}
+	return ret
+}
+
+// optimizer holds the rules of a grammar being refined by Optimize.
+type optimizer struct {
+	rootID SymbolID
+	nextID SymbolID // the largest ID so far
+	bodies map[SymbolID]SymbolIDslice
+}
+
+// size of the grammar, as for Compact.Size.
+func (o *optimizer) size() int {
+	return bodiesSize(o.bodies)
+}
+
+// order gives the rules in ascending order of ID, so that the refinements are deterministic.
+func (o *optimizer) order() SymbolIDslice {
+	return sortedIDs(o.bodies)
+}
+
+// removeUnused removes the rules which are not reachable from the root.
+func (o *optimizer) removeUnused() {
+	seen := map[SymbolID]bool{o.rootID: true}
+	queue := SymbolIDslice{o.rootID}
+	for len(queue) > 0 {
+		sid := queue[0]
+		queue = queue[1:]
+		for _, child := range o.bodies[sid] {
+			if child.IsRule() && !seen[child] {
+				seen[child] = true
+				queue = append(queue, child)
+			}
+		}
+	}
+	for sid := range o.bodies {
+		if !seen[sid] {
+			delete(o.bodies, sid)
+		}
+	}
+}
+
+// rebalance uses each rule wherever its contents are found within another rule, longest rules first.
+// No rule can contain the contents of a rule which uses it, so this cannot make a rule use itself.
+// The rules are held as linked lists, with the positions of each digram, so that the contents of a rule
+// are only sought where its first digram is found. Rules of one symbol are left to inline.
+func (o *optimizer) rebalance() {
+	order := o.order()
+	sort.SliceStable(order, func(i, j int) bool { return len(o.bodies[order[i]]) > len(o.bodies[order[j]]) })
+	var seq SymbolIDslice
+	var prev, next, owner []int // the neighbours of each symbol, or -1 at the ends, and the index in order of its rule
+	removed := make([]bool, 0, o.size())
+	starts := make([]int, len(order))
+	lengths := make([]int, len(order))
+	at := make(map[pair][]int) // the positions of each digram, some of which may be stale
+	for k, sid := range order {
+		body := o.bodies[sid]
+		starts[k], lengths[k] = len(seq), len(body)
+		for i, s := range body {
+			seq = append(seq, s)
+			prev, next, owner = append(prev, len(seq)-2), append(next, len(seq)), append(owner, k)
+			removed = append(removed, false)
+			if i == 0 {
+				prev[len(seq)-1] = -1
+			} else {
+				at[pair{body[i-1], s}] = append(at[pair{body[i-1], s}], len(seq)-2)
+			}
+		}
+		if len(body) > 0 {
+			next[len(seq)-1] = -1
+		}
+	}
+
+	// match gives the position after the contents of a rule found at position i, or -2 if they are not found there
+	match := func(i int, body SymbolIDslice) int {
+		for _, s := range body {
+			if i < 0 || seq[i] != s {
+				return -2
+			}
+			i = next[i]
+		}
+		return i
+	}
+	checked := make([]int, len(order)) // 1 + the last rule whose contents were sought in each rule
+	longer := make([]bool, len(order)) // whether each rule was longer than that rule, and so searched for them
+	for k, sid := range order {
+		body := o.bodies[sid]
+		if sid == o.rootID || len(body) < 2 {
+			continue
+		}
+		positions := at[pair{body[0], body[1]}]
+		sort.Ints(positions)
+		for _, i := range positions {
+			other := owner[i]
+			if removed[i] || other == k {
+				continue
+			}
+			if checked[other] != 1+k {
+				checked[other], longer[other] = 1+k, lengths[other] > len(body)
+			}
+			if !longer[other] {
+				continue
+			}
+			end := match(i, body)
+			if end == -2 {
+				continue
+			}
+			for j := next[i]; j != end; j = next[j] {
+				removed[j] = true
+			}
+			seq[i], next[i] = sid, end
+			lengths[other] -= len(body) - 1
+			if end >= 0 {
+				prev[end] = i
+				at[pair{sid, seq[end]}] = append(at[pair{sid, seq[end]}], i)
+			}
+			if prev[i] >= 0 {
+				at[pair{seq[prev[i]], sid}] = append(at[pair{seq[prev[i]], sid}], prev[i])
+			}
+		}
+	}
+
+	for k, sid := range order {
+		body := make(SymbolIDslice, 0, lengths[k])
+		for i := starts[k]; i >= 0 && lengths[k] > 0; i = next[i] {
+			body = append(body, seq[i])
+		}
+		o.bodies[sid] = body
+	}
+}
+
+// extract the repeats which occur often enough to reduce the size of the grammar into new rules, longest first.
+// A repeat of n symbols which occurs m times saves (m-1)(n-1)-1 symbols, so repeats of three or more symbols are
+// extracted if they occur twice, and digrams if they occur three times.
+func (o *optimizer) extract() {
+	o.nextID = replaceRepeats(o.bodies, o.order(), o.rootID, o.nextID, 3)
+	o.nextID = replaceDigrams(o.bodies, o.order(), o.rootID, o.nextID, 3)
+}
+
+// inline the rules which do not reduce the size of the grammar: those used once, those with one symbol,
+// and those with two symbols used twice. A rule of n symbols used m times saves (m-1)(n-1)-1 symbols.
+// Each rule is visited once, after the rules it contains, so its contents include those of the rules inlined
+// into it, and before the rules which use it, so its uses are not yet changed by inlining them. Inlining a rule
+// only adds to the uses of the rules it contains, so those which were kept are still worth keeping.
+func (o *optimizer) inline() {
+	used := references(o.bodies)
+	kept := make(map[SymbolID]SymbolIDslice, len(o.bodies))
+	inlined := make(map[SymbolID]SymbolIDslice)
+	for _, sid := range o.bottomUp() {
+		var body SymbolIDslice
+		for _, child := range o.bodies[sid] {
+			if contents, found := inlined[child]; found {
+				body = append(body, contents...)
+			} else {
+				body = append(body, child)
+			}
+		}
+		if m, n := used[sid], len(body); sid != o.rootID && (m-1)*(n-1)-1 <= 0 {
+			inlined[sid] = body
+		} else {
+			kept[sid] = body
+		}
+	}
+	o.bodies = kept
+}
+
+// bottomUp lists the rules reachable from the root, each after the rules it contains.
+func (o *optimizer) bottomUp() SymbolIDslice {
+	seen := make(map[SymbolID]bool)
+	post := make(SymbolIDslice, 0, len(o.bodies))
+	var visit func(sid SymbolID)
+	visit = func(sid SymbolID) {
+		seen[sid] = true
+		for _, child := range o.bodies[sid] {
+			if child.IsRule() && !seen[child] {
+				visit(child)
+			}
+		}
+		post = append(post, sid)
+	}
+	visit(o.rootID)
+	return post
+}
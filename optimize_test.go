@@ -0,0 +1,63 @@
+package sequitur
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+)
+
+func ExampleCompact_Optimize() {
+
+	in, err := ioutil.ReadFile("testdata/sam.input")
+	if err != nil {
+		panic(err)
+	}
+
+	comp := Parse(in).Compact()
+	optimized := comp.Optimize(OptimizeOptions{})
+	fmt.Println(comp.Size(), "->", optimized.Size())
+	fmt.Println(bytes.Equal(optimized.Bytes(optimized.RootID), in))
+
+	// Output:
+	// 975 -> 912
+	// true
+}
+
+func TestOptimize(t *testing.T) {
+	check := func(in []byte, comp *Compact, opts OptimizeOptions) {
+		optimized := comp.Optimize(opts)
+		if got := optimized.Bytes(optimized.RootID); !bytes.Equal(got, in) {
+			t.Fatalf("%q %+v: got %q", in, opts, got)
+		}
+		if optimized.Size() > comp.Size() {
+			t.Fatalf("%q %+v: size %d, was %d", in, opts, optimized.Size(), comp.Size())
+		}
+		if err := checkUsed(optimized, 1); err != nil {
+			t.Fatalf("%q %+v: %v", in, opts, err)
+		}
+		for sid, entry := range optimized.Map {
+			if sid != optimized.RootID && !opts.NoInline && (entry.Used-1)*(len(entry.IDs)-1)-1 <= 0 {
+				t.Fatalf("%q %+v: rule %v used %d times, with %d symbols", in, opts, sid, entry.Used, len(entry.IDs))
+			}
+		}
+	}
+
+	allOpts := []OptimizeOptions{{}, {NoInline: true}, {NoRebalance: true}, {NoExtract: true}, {MaxPasses: 1}}
+	if comp := Parse(nil).Compact().Optimize(OptimizeOptions{}); comp.RootID != EmptySymbolID {
+		t.Errorf("empty grammar gave %v", comp)
+	}
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		in := randomInput(rnd, i, 500, "abc\xff")
+		check(in, Parse(in).Compact(), allOpts[i%len(allOpts)])
+	}
+
+	_, ins := testFiles(t)
+	for _, in := range ins {
+		for _, opts := range allOpts {
+			check(in, Parse(in).Compact(), opts)
+		}
+	}
+}
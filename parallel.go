@@ -0,0 +1,188 @@
+package sequitur
+
+import (
+	"encoding/binary"
+	"runtime"
+	"sync"
+	"unicode/utf8"
+)
+
+// ParseParallel parses the given bytes, as adjusted by the options, splitting them into chunks which are parsed
+// concurrently. The grammars of the chunks are then merged in pairs, each pair concurrently with the others, until
+// one is left: the rules of the second grammar of a pair are unified with identical rules of the first, or copied
+// into it, and only the digrams of the copied rules, and that spanning the boundary, are checked, so that the result
+// is a valid grammar. It differs from, and is larger than, the grammar given by Parse, as repeats spanning a chunk
+// boundary can only be found where they are made of whole rules, and the more chunks the larger it is. The last merge
+// copies the rules of half of the chunks, so the speed-up is well below the number of chunks, and ParseParallel is
+// only worthwhile for large inputs where time matters more than size. The number of chunks defaults to
+// runtime.NumCPU() if chunks <= 0. With one chunk, the grammar is given by Parse.
+func ParseParallel(str []byte, opts Options, chunks int) *Grammar {
+	if chunks <= 0 {
+		chunks = runtime.NumCPU()
+	}
+	pieces := splitChunks(str, chunks)
+	if len(pieces) <= 1 {
+		return ParseWithOptions(str, opts)
+	}
+	g := parseMerged(pieces, Options{Barriers: opts.Barriers, K: opts.K}).g
+	g.window = opts.Window
+	for g.window > 0 && g.length > g.window {
+		g.dropFront()
+	}
+	return g
+}
+
+// parseMerged parses the pieces, the first and second halves concurrently, then merges the grammar of the second
+// half into that of the first.
+func parseMerged(pieces [][]byte, opts Options) *merger {
+	if len(pieces) == 1 {
+		return newMerger(ParseWithOptions(pieces[0], opts))
+	}
+	var m *merger
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		m = parseMerged(pieces[:len(pieces)/2], opts)
+	}()
+	other := parseMerged(pieces[len(pieces)/2:], opts)
+	wg.Wait()
+	m.merge(other.g)
+	return m
+}
+
+// enforceInvariants makes a grammar whose rules were built from another grammar valid for Append, as if it had been
+// parsed: the rules used once are expanded, every digram of the rules, then of the root, is checked, as if appending
+// it, so repeated digrams form rules, and symbols are dropped from the front to fit the window. The bodies are
+// the symbols inserted in each rule, then in the root, listed before any rule can be removed by the checks.
+func (g *Grammar) enforceInvariants(created []*rules, bodies [][]*symbols) {
+	g.trackUses()
+	for _, r := range created {
+		if r.count == 1 {
+			r.uses.expand()
+			g.checkPending()
+		}
+	}
+	for _, body := range bodies {
+		for _, s := range body {
+			if s.inUse() {
+				s.check()
+				g.checkPending()
+			}
+		}
+	}
+	for g.window > 0 && g.length > g.window {
+		g.dropFront()
+	}
+}
+
+// splitChunks splits str into at most n pieces of similar length, without splitting a rune.
+func splitChunks(str []byte, n int) [][]byte {
+	var ret [][]byte
+	for i := n; i > 0 && len(str) > 0; i-- {
+		end := len(str) / i
+		for end < len(str) && !utf8.RuneStart(str[end]) {
+			end++
+		}
+		if end == 0 {
+			continue
+		}
+		ret = append(ret, str[:end])
+		str = str[end:]
+	}
+	return ret
+}
+
+// merger copies the rules of other grammars into a grammar.
+type merger struct {
+	g       *Grammar
+	bodies  map[string]*rules // the rules of g by their bodies, encoded by bodyKey, some of which may have changed since
+	rules   map[*rules]*rules // the rule of g for each rule of the grammar being merged
+	merged  []*rules          // the rules copied into g, in the order they were created
+	created [][]*symbols      // the symbols of each copied rule, to be checked
+}
+
+// newMerger indexes the rules of a grammar, for other grammars to be merged into it.
+func newMerger(g *Grammar) *merger {
+	g.trackUses()
+	m := &merger{g: g, bodies: make(map[string]*rules)}
+	seen := map[*rules]bool{g.base: true}
+	for queue := []*rules{g.base}; len(queue) > 0; queue = queue[1:] {
+		for p := queue[0].first(); !p.isGuard(); p = p.next {
+			if p.isNonTerminal() && !seen[p.rule] {
+				seen[p.rule] = true
+				queue = append(queue, p.rule)
+				m.bodies[m.bodyKey(p.rule)] = p.rule
+			}
+		}
+	}
+	return m
+}
+
+// merge appends another grammar to g, which is left valid.
+func (m *merger) merge(other *Grammar) {
+	m.rules, m.merged, m.created = make(map[*rules]*rules), nil, nil
+	var root []*symbols // in place before any rule can be removed by check
+	if last := m.g.base.last(); !last.isGuard() {
+		root = append(root, last) // for the digram spanning the boundary
+	}
+	for p := other.base.first(); !p.isGuard(); p = p.next {
+		m.mergeRule(p)
+		m.g.base.last().insertAfter(m.symbol(p))
+		root = append(root, m.g.base.last())
+	}
+	m.g.length += other.length
+	m.g.appended += other.appended
+	// a rule used by only one rule of the other grammar may be used once in all
+	m.g.enforceInvariants(m.merged, append(m.created, root))
+}
+
+// mergeRule ensures that the rule of a non-terminal symbol of the grammar being merged, and all the rules it uses,
+// are merged. A rule of g is only used for it if its body is still the same.
+func (m *merger) mergeRule(s *symbols) {
+	if !s.isNonTerminal() {
+		return
+	}
+	if _, done := m.rules[s.rule]; done {
+		return
+	}
+	for p := s.rule.first(); !p.isGuard(); p = p.next {
+		m.mergeRule(p)
+	}
+	key := m.bodyKey(s.rule)
+	r, exists := m.bodies[key]
+	if !exists || r.count < 2 || m.bodyKey(r) != key { // removed rules are left with one use
+		r = m.g.newRules()
+		var body []*symbols
+		for p := s.rule.first(); !p.isGuard(); p = p.next {
+			r.last().insertAfter(m.symbol(p))
+			body = append(body, r.last())
+		}
+		m.bodies[key] = r
+		m.merged = append(m.merged, r)
+		m.created = append(m.created, body)
+	}
+	m.rules[s.rule] = r
+}
+
+// symbol gives a new symbol in g equivalent to a symbol of the grammar being merged.
+func (m *merger) symbol(s *symbols) *symbols {
+	if s.isNonTerminal() {
+		return m.g.newSymbolFromRule(m.rules[s.rule])
+	}
+	return m.g.newSymbolFromValue(s.value)
+}
+
+// bodyKey encodes the body of a rule of g, or of the grammar being merged, in terms of the values of the symbols of g.
+func (m *merger) bodyKey(r *rules) string {
+	var key []byte
+	var buf [binary.MaxVarintLen64]byte
+	for p := r.first(); !p.isGuard(); p = p.next {
+		v := p.value
+		if merged, found := m.rules[p.rule]; p.isNonTerminal() && found {
+			v = merged.id
+		}
+		key = append(key, buf[:binary.PutUvarint(buf[:], v)]...)
+	}
+	return string(key)
+}
@@ -0,0 +1,74 @@
+package sequitur
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestParseParallel(t *testing.T) {
+	check := func(in []byte, opts Options, chunks int) *Grammar {
+		g := ParseParallel(in, opts, chunks)
+		if err := checkInvariants(g); err != nil {
+			t.Fatalf("%d chunks of %q: %v", chunks, in, err)
+		}
+		want := []rune(string(in))
+		if opts.Window > 0 && len(want) > opts.Window {
+			want = want[len(want)-opts.Window:]
+		}
+		var b bytes.Buffer
+		if err := g.Print(&b); err != nil || b.String() != string(want) || g.Len() != len(want) {
+			t.Fatalf("%d chunks of %q: got %q", chunks, in, b.Bytes())
+		}
+		return g
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 300; i++ {
+		in := randomInput(rnd, i, 1000, "abc\n")
+		opts := Options{}
+		if i%3 == 0 {
+			opts.Barriers = []rune{'\n'}
+		}
+		if i%5 == 0 {
+			opts.Window = rnd.Intn(100)
+		}
+		if i%4 == 0 {
+			opts.K = 3 + i%3
+		}
+		check(in, opts, rnd.Intn(10))
+	}
+
+	files, ins := testFiles(t)
+	var all []byte
+	for f, in := range ins {
+		all = append(all, in...)
+		serial := Parse(in).Compact().Size()
+		for _, chunks := range []int{1, 4, 16} {
+			parallel := check(in, Options{}, chunks).Compact().Size()
+			if chunks == 1 && (parallel != serial || !reflect.DeepEqual(ParseParallel(in, Options{}, 1).Compact(), Parse(in).Compact())) {
+				t.Errorf("%s: one chunk gave size %d, Parse gave %d", files[f], parallel, serial)
+			}
+		}
+	}
+	// only repeats made of whole rules are found across chunks, so small chunks compress less well
+	serial := Parse(all).Compact().Size()
+	if parallel := check(all, Options{}, 4).Compact().Size(); float64(parallel) > 1.25*float64(serial) {
+		t.Errorf("4 chunks gave size %d, Parse gave %d", parallel, serial)
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	in := bytes.Repeat([]byte(testImportance), 20)
+	for i := 0; i < b.N; i++ {
+		Parse(in)
+	}
+}
+
+func BenchmarkParseParallel(b *testing.B) {
+	in := bytes.Repeat([]byte(testImportance), 20)
+	for i := 0; i < b.N; i++ {
+		ParseParallel(in, Options{}, 0)
+	}
+}
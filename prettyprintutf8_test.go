@@ -3,6 +3,7 @@ package sequitur
 import (
 	"bytes"
 	"fmt"
+	"strings"
 )
 
 const testString = `
@@ -69,3 +70,29 @@ func ExamplePrettyPrintUTF8() {
 	// 25 -> i n
 	// 26 -> , \n
 }
+
+func ExampleParseWithOptions() {
+
+	g := ParseWithOptions([]byte(testString[:strings.Index(testString, "《")]), Options{Barriers: []rune{'\n'}})
+
+	var output bytes.Buffer
+	if err := g.PrettyPrint(&output); err != nil {
+		panic(err)
+	}
+
+	fmt.Println(output.String())
+
+	// Output:
+	// 0 -> \n 1 2 \n 1 3 \n 1 4 \n 5 \n \n 6 2 \n 6 3 \n 6 4 \n 5 \n \n
+	// 1 -> p e a s 7 r r i d g 8
+	// 2 -> h o 9
+	// 3 -> c 10 ,
+	// 4 -> 11 _ t h 7 9
+	// 5 -> n 11 8 d a y s _ 10 .
+	// 6 -> s o m 8 l i k 8 i t _
+	// 7 -> 8 p o
+	// 8 -> e _
+	// 9 -> t ,
+	// 10 -> o l d
+	// 11 -> i n
+}
@@ -0,0 +1,134 @@
+package sequitur
+
+import "errors"
+
+// ErrCompact is returned when rebuilding a Grammar from a Compact grammar which is not valid: one whose root or rules
+// are missing, whose rules use themselves, or which contains SymbolIDs which are neither runes, bytes nor rules.
+var ErrCompact = errors.New("sequitur: invalid Compact grammar")
+
+// FromCompact rebuilds a Grammar from its Compact form, so that more input may be appended to it
+// without parsing the original input again.
+func FromCompact(comp *Compact) (*Grammar, error) {
+	return FromCompactWithOptions(comp, Options{})
+}
+
+// FromCompactWithOptions rebuilds a Grammar from its Compact form, as adjusted by the options, which are not
+// recorded in the Compact form. The rules keep their SymbolIDs, and new rules are numbered after them.
+// The Compact form of a Grammar gives the same grammar, but any other grammar, such as one given by RePair or
+// Optimize, is made valid for Append as ParseParallel does: rules of one symbol, or used once, are expanded,
+// and every digram is checked, so repeated digrams form rules.
+func FromCompactWithOptions(comp *Compact, opts Options) (*Grammar, error) {
+	g := NewGrammar(opts)
+	if comp == nil || comp.RootID == EmptySymbolID {
+		return g, nil
+	}
+	if _, found := comp.Map[comp.RootID]; !found || !comp.RootID.IsRule() {
+		return nil, ErrCompact
+	}
+	g.base = &rules{id: uint64(comp.RootID)}
+	g.base.guard = g.newGuard(g.base)
+	rh := &rehydrator{
+		g:        g,
+		comp:     comp,
+		resolved: make(map[SymbolID]*symbols),
+		visiting: make(map[SymbolID]bool),
+		lengths:  make(map[SymbolID]int),
+	}
+	if err := rh.rule(comp.RootID); err != nil {
+		return nil, err
+	}
+	g.length = rh.lengths[comp.RootID]
+	g.appended = g.length
+
+	// a rule may be used once, if the grammar was not given by Parse
+	g.enforceInvariants(rh.created, append(rh.bodies, rh.root))
+	return g, nil
+}
+
+// rehydrator builds the rules of a Grammar from a Compact grammar.
+type rehydrator struct {
+	g        *Grammar
+	comp     *Compact
+	resolved map[SymbolID]*symbols // the guard of the rule for each SymbolID, or the symbol replacing a rule of one symbol
+	visiting map[SymbolID]bool     // the rules being built, to detect rules which use themselves
+	lengths  map[SymbolID]int      // the number of terminal symbols in the expansion of each rule
+	created  []*rules              // the rules, after the rules they use
+	bodies   [][]*symbols          // the symbols of each rule, to be checked
+	root     []*symbols            // the symbols of the root, to be checked
+}
+
+// rule builds the rule with the given SymbolID, after the rules it uses.
+func (rh *rehydrator) rule(sid SymbolID) error {
+	entry := rh.comp.Map[sid]
+	rh.visiting[sid] = true
+	length := 0
+	for _, child := range entry.IDs {
+		switch {
+		case rh.visiting[child]:
+			return ErrCompact
+		case child.IsRule():
+			if _, done := rh.resolved[child]; !done {
+				if _, found := rh.comp.Map[child]; !found || len(rh.comp.Map[child].IDs) == 0 {
+					return ErrCompact
+				}
+				if err := rh.rule(child); err != nil {
+					return err
+				}
+			}
+		case child < 128: // not a runeOrByte
+			return ErrCompact
+		}
+		length += rh.length(child)
+	}
+	delete(rh.visiting, sid)
+	rh.lengths[sid] = length
+
+	if sid == rh.comp.RootID {
+		for _, child := range entry.IDs {
+			rh.g.base.last().insertAfter(rh.symbol(child))
+			rh.root = append(rh.root, rh.g.base.last())
+		}
+		return nil
+	}
+	if len(entry.IDs) == 1 { // used in place of the rule
+		if s, found := rh.resolved[entry.IDs[0]]; found {
+			rh.resolved[sid] = s
+		} else {
+			rh.resolved[sid] = rh.g.newSymbolFromValue(uint64(entry.IDs[0]))
+		}
+		return nil
+	}
+	r := &rules{id: uint64(sid)}
+	r.guard = rh.g.newGuard(r)
+	if r.id > rh.g.ruleID {
+		rh.g.ruleID = r.id
+	}
+	var body []*symbols
+	for _, child := range entry.IDs {
+		r.last().insertAfter(rh.symbol(child))
+		body = append(body, r.last())
+	}
+	rh.resolved[sid] = r.guard
+	rh.created = append(rh.created, r)
+	rh.bodies = append(rh.bodies, body)
+	return nil
+}
+
+// symbol gives a new symbol for a SymbolID whose rule, if any, has been built.
+func (rh *rehydrator) symbol(sid SymbolID) *symbols {
+	if s, found := rh.resolved[sid]; found {
+		if s.isNonTerminal() {
+			return rh.g.newSymbolFromRule(s.rule)
+		}
+		return rh.g.newSymbolFromValue(s.value)
+	}
+	return rh.g.newSymbolFromValue(uint64(sid))
+}
+
+// length gives the number of terminal symbols in the expansion of a SymbolID whose rule, if any, has been built.
+func (rh *rehydrator) length(sid SymbolID) int {
+	if sid.IsRule() {
+		return rh.lengths[sid]
+	}
+	return 1
+}
@@ -0,0 +1,114 @@
+package sequitur
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func ExampleFromCompact() {
+
+	comp := Parse([]byte("Round and round the ragged rocks, ")).Compact()
+
+	g, err := FromCompact(comp)
+	if err != nil {
+		panic(err)
+	}
+	g.Append([]byte("the ragged rascal ran."))
+
+	var output bytes.Buffer
+	if err := g.PrettyPrint(&output); err != nil {
+		panic(err)
+	}
+	fmt.Println(string(output.Bytes()))
+
+	// Output:
+	// 0 -> R 1 a 2 r 1 3 o c k s , _ 3 a s c a l 4 n .
+	// 1 -> o u 2
+	// 2 -> n 5
+	// 3 -> t h e 4 g g e 5 r
+	// 4 -> _ r a
+	// 5 -> d _
+}
+
+func TestFromCompact(t *testing.T) {
+	prettyPrint := func(g *Grammar) string {
+		var b bytes.Buffer
+		if err := g.PrettyPrint(&b); err != nil {
+			t.Fatal(err)
+		}
+		return b.String()
+	}
+	check := func(in, more []byte, comp *Compact, opts Options) *Grammar {
+		g, err := FromCompactWithOptions(comp, opts)
+		if err != nil {
+			t.Fatalf("%q: %v", in, err)
+		}
+		g.Append(more)
+		if err := checkInvariants(g); err != nil {
+			t.Fatalf("%q then %q: %v", in, more, err)
+		}
+		want := []rune(string(in) + string(more))
+		if opts.Window > 0 && len(want) > opts.Window {
+			want = want[len(want)-opts.Window:]
+		}
+		var b bytes.Buffer
+		if err := g.Print(&b); err != nil || b.String() != string(want) || g.Len() != len(want) {
+			t.Fatalf("%q then %q: got %q", in, more, b.Bytes())
+		}
+		return g
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 300; i++ {
+		in := randomInput(rnd, i, 500, "abc\n")
+		split := rnd.Intn(len(in) + 1)
+		opts := Options{}
+		if i%3 == 0 {
+			opts.Barriers = []rune{'\n'}
+		}
+		g := ParseWithOptions(in[:split], opts)
+		rebuilt := check(in[:split], in[split:], g.Compact(), opts)
+		g.Append(in[split:])
+		if got, want := prettyPrint(rebuilt), prettyPrint(g); got != want {
+			t.Fatalf("%q then %q: got\n%s\nwant\n%s", in[:split], in[split:], got, want)
+		}
+
+		if i%5 == 0 {
+			opts.Window = rnd.Intn(100)
+		}
+		if i%4 == 0 {
+			opts.K = 3 + i%3
+		}
+		check(in[:split], in[split:], RePair(in[:split]), opts)
+		check(in[:split], in[split:], LZ78(in[:split]).Optimize(OptimizeOptions{}), opts)
+	}
+
+	files, ins := testFiles(t)
+	for f, in := range ins {
+		comp := Parse(in).Compact()
+		g := check(in, nil, comp, Options{})
+		if got, want := g.Compact().String(), comp.String(); got != want {
+			t.Errorf("%s: rebuilt grammar differs", files[f])
+		}
+	}
+
+	root := SymbolID(rootRuleID)
+	for _, comp := range []*Compact{
+		{RootID: root},
+		{RootID: 'a' + 256, Map: map[SymbolID]CompactEntry{'a' + 256: {}}},
+		{RootID: root, Map: map[SymbolID]CompactEntry{root: {IDs: SymbolIDslice{root + 1}}}},
+		{RootID: root, Map: map[SymbolID]CompactEntry{root: {IDs: SymbolIDslice{root}}}},
+		{RootID: root, Map: map[SymbolID]CompactEntry{root: {IDs: SymbolIDslice{'a'}}}},
+		{RootID: root, Map: map[SymbolID]CompactEntry{
+			root:     {IDs: SymbolIDslice{root + 1}},
+			root + 1: {Used: 1, IDs: SymbolIDslice{root + 2, 'a' + 256}},
+			root + 2: {Used: 1, IDs: SymbolIDslice{root + 1, 'b' + 256}},
+		}},
+	} {
+		if _, err := FromCompact(comp); err != ErrCompact {
+			t.Errorf("%v gave %v", comp, err)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package sequitur
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// RePair builds a grammar for the given bytes with the offline Re-Pair algorithm, which repeatedly replaces
+// the most frequent digram in the input by a new rule, until no digram occurs twice. Ties are broken by
+// the SymbolIDs of the digram, so the result is deterministic. Rules left with only one use, as their uses
+// were themselves replaced, are expanded where they are used. The result is typically smaller than the
+// grammar given by Parse, and has the same form, so may be used in the same way.
+func RePair(str []byte) *Compact {
+	if len(str) == 0 {
+		return emptyCompact()
+	}
+
+	rp := newRePair()
+	rootID := SymbolID(rootRuleID)
+	nextID := rootID
+	var seq SymbolIDslice
+	eachRuneOrByte(str, func(rb runeOrByte) {
+		seq = append(seq, SymbolID(rb))
+	})
+	start := rp.appendSequence(seq)
+
+	for {
+		p, found, ok := rp.pop(2)
+		if !ok {
+			break
+		}
+		nextID++
+		rp.bodies[nextID] = SymbolIDslice{p.left, p.right}
+		rp.replaceAll(p, found, nextID)
+	}
+
+	rp.bodies[rootID] = rp.sequence(start)
+	return compactFromBodies(rootID, rp.bodies)
+}
+
+// replaceDigrams replaces the digrams which occur at least minCount times without overlapping in the rules, taken
+// in the given order, by new rules, most frequent first, as RePair does, giving the largest ID of the rules.
+// A digram which is the contents of a rule other than the root is replaced by that rule.
+func replaceDigrams(bodies map[SymbolID]SymbolIDslice, order SymbolIDslice, rootID, nextID SymbolID,
+	minCount int) SymbolID {
+	rp := newRePair()
+	starts := make([]int, len(order))  // the index in rp.seq of the first symbol of each rule
+	rules := make(map[pair]SymbolID)   // the rules of two symbols, by their contents
+	contents := make(map[SymbolID]int) // the index in rp.seq of the contents of each of those rules
+	for k, sid := range order {
+		body := bodies[sid]
+		starts[k] = rp.appendSequence(body)
+		if len(body) == 2 && sid != rootID {
+			rules[pair{body[0], body[1]}] = sid
+			contents[sid] = starts[k]
+		}
+	}
+	for {
+		p, found, ok := rp.pop(minCount)
+		if !ok {
+			break
+		}
+		rule, exists := rules[p]
+		if !exists {
+			nextID++
+			rule = nextID
+			bodies[rule] = SymbolIDslice{p.left, p.right}
+			rules[p] = rule
+		}
+		uses := found[:0]
+		for _, i := range found {
+			if own, isRule := contents[rule]; !isRule || i != own {
+				uses = append(uses, i)
+			}
+		}
+		rp.replaceAll(p, uses, rule)
+	}
+	for k, sid := range order {
+		if starts[k] >= 0 {
+			bodies[sid] = rp.sequence(starts[k])
+		}
+	}
+	return nextID
+}
+
+// pair is a digram of SymbolIDs.
+type pair struct{ left, right SymbolID }
+
+// rePair holds the state of the Re-Pair algorithm. The input is a linked list over seq, from which symbols
+// are removed as digrams are replaced.
+type rePair struct {
+	seq        []SymbolID
+	prev, next []int                      // the indexes of the neighbouring symbols in seq, or -1 at the ends
+	counts     map[pair]int               // the number of occurrences of each digram, which may include overlapping ones
+	positions  map[pair][]int             // the indexes in seq of occurrences of each digram, some of which may be stale
+	queue      pairQueue                  // the digrams by count, some of which may be stale
+	bodies     map[SymbolID]SymbolIDslice // the two symbols of each rule, then of the root
+}
+
+func newRePair() *rePair {
+	return &rePair{
+		counts:    make(map[pair]int),
+		positions: make(map[pair][]int),
+		bodies:    make(map[SymbolID]SymbolIDslice),
+	}
+}
+
+// appendSequence adds a sequence of symbols to the input, counting its digrams, but none spanning it and the sequence
+// before it. It gives the index in seq of its first symbol, which is never removed, or -1 if it is empty.
+func (rp *rePair) appendSequence(seq SymbolIDslice) int {
+	if len(seq) == 0 {
+		return -1
+	}
+	start := len(rp.seq)
+	for k, sid := range seq {
+		i := len(rp.seq)
+		rp.seq = append(rp.seq, sid)
+		rp.prev = append(rp.prev, i-1)
+		rp.next = append(rp.next, i+1)
+		if k == 0 {
+			rp.prev[i] = -1
+		} else {
+			rp.add(i - 1)
+		}
+	}
+	rp.next[len(rp.seq)-1] = -1
+	return start
+}
+
+// sequence gives the symbols of the sequence added by appendSequence, as replaced so far.
+func (rp *rePair) sequence(start int) SymbolIDslice {
+	var ret SymbolIDslice
+	for i := start; i >= 0; i = rp.next[i] {
+		ret = append(ret, rp.seq[i])
+	}
+	return ret
+}
+
+// pop takes the most frequent digram from the queue, with the occurrences of it which do not overlap,
+// if it has at least minCount of them, or gives false if no digram has.
+func (rp *rePair) pop(minCount int) (pair, []int, bool) {
+	for rp.queue.Len() > 0 {
+		top := heap.Pop(&rp.queue).(pairCount)
+		if top.count != rp.counts[top.pair] {
+			continue // stale
+		}
+		if top.count < minCount {
+			break // as are all of the others
+		}
+		found := rp.occurrences(top.pair)
+		if len(found) < minCount {
+			continue // only overlapping occurrences, which may be counted again as the input changes
+		}
+		return top.pair, found, true
+	}
+	return pair{}, nil, false
+}
+
+// replaceAll replaces the occurrences of the digram given by pop by the rule.
+func (rp *rePair) replaceAll(p pair, found []int, rule SymbolID) {
+	for _, i := range found {
+		rp.replace(i, rule)
+	}
+	delete(rp.counts, p)
+	delete(rp.positions, p)
+}
+
+// add the digram starting at index i.
+func (rp *rePair) add(i int) {
+	p := pair{rp.seq[i], rp.seq[rp.next[i]]}
+	rp.counts[p]++
+	rp.positions[p] = append(rp.positions[p], i)
+	if rp.counts[p] > 1 {
+		heap.Push(&rp.queue, pairCount{p, rp.counts[p]})
+	}
+}
+
+// remove the digram starting at index i.
+func (rp *rePair) remove(i int) {
+	p := pair{rp.seq[i], rp.seq[rp.next[i]]}
+	if rp.counts[p]--; rp.counts[p] > 1 {
+		heap.Push(&rp.queue, pairCount{p, rp.counts[p]})
+	}
+}
+
+// occurrences gives the indexes of the occurrences of the digram still in the input, from left to right,
+// skipping those which overlap the previous one.
+func (rp *rePair) occurrences(p pair) []int {
+	positions := rp.positions[p]
+	sort.Ints(positions)
+	var ret []int
+	last := -1
+	for k, i := range positions {
+		if k > 0 && i == positions[k-1] {
+			continue // recorded twice
+		}
+		if rp.seq[i] != p.left || rp.next[i] < 0 || rp.seq[rp.next[i]] != p.right || rp.prev[i] == -2 {
+			continue // stale
+		}
+		if last >= 0 && rp.next[last] == i {
+			continue // overlapping
+		}
+		ret = append(ret, i)
+		last = i
+	}
+	return ret
+}
+
+// replace the digram starting at index i by the rule.
+func (rp *rePair) replace(i int, rule SymbolID) {
+	j := rp.next[i]
+	if rp.prev[i] >= 0 {
+		rp.remove(rp.prev[i])
+	}
+	if rp.next[j] >= 0 {
+		rp.remove(j)
+	}
+	rp.seq[i] = rule
+	rp.next[i] = rp.next[j]
+	if rp.next[j] >= 0 {
+		rp.prev[rp.next[j]] = i
+	}
+	rp.prev[j] = -2 // removed
+	if rp.prev[i] >= 0 {
+		rp.add(rp.prev[i])
+	}
+	if rp.next[i] >= 0 {
+		rp.add(i)
+	}
+}
+
+// pairCount is an entry in a pairQueue.
+type pairCount struct {
+	pair  pair
+	count int
+}
+
+// pairQueue is a heap of digrams, the most frequent first, then ordered by their SymbolIDs.
+type pairQueue []pairCount
+
+func (q pairQueue) Len() int { return len(q) }
+func (q pairQueue) Less(i, j int) bool {
+	if q[i].count != q[j].count {
+		return q[i].count > q[j].count
+	}
+	if q[i].pair.left != q[j].pair.left {
+		return q[i].pair.left < q[j].pair.left
+	}
+	return q[i].pair.right < q[j].pair.right
+}
+func (q pairQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *pairQueue) Push(x interface{}) { *q = append(*q, x.(pairCount)) }
+func (q *pairQueue) Pop() interface{} {
+	old := *q
+	x := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return x
+}
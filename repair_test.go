@@ -0,0 +1,53 @@
+package sequitur
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func ExampleRePair() {
+
+	comp := RePair([]byte(testCompact))
+
+	var output bytes.Buffer
+	if err := comp.PrettyPrint(&output); err != nil {
+		panic(err)
+	}
+
+	fmt.Println(string(output.Bytes()))
+
+	// Output:
+	// 1114369 -> {0 [R 1114381   a 1114372 1114370 1114381 1114382 1114370 o c k s , 1114382 1114371 s c a l 1114371 n .]}
+	// 1114370 -> {3 [  r]}
+	// 1114371 -> {3 [1114370 a]}
+	// 1114372 -> {2 [n d]}
+	// 1114381 -> {2 [o u 1114372]}
+	// 1114382 -> {2 [  t h e 1114371 g g e d]}
+}
+
+func TestRePair(t *testing.T) {
+	check := func(in []byte) *Compact {
+		comp := RePair(in)
+		if err := checkInferred(comp, in); err != nil {
+			t.Fatalf("%q: %v, in\n%v", in, err, comp)
+		}
+		return comp
+	}
+
+	if comp := check(nil); comp.RootID != EmptySymbolID || len(comp.Map) != 0 {
+		t.Errorf("empty input gave %v", comp)
+	}
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 300; i++ {
+		check(randomInput(rnd, i, 1000, "abc\xff"))
+	}
+
+	files, ins := testFiles(t)
+	for f, in := range ins {
+		if rePair, sequitur := check(in).Size(), Parse(in).Compact().Size(); rePair > sequitur {
+			t.Errorf("%s: Re-Pair gave size %d, Parse gave %d", files[f], rePair, sequitur)
+		}
+	}
+}
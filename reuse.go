@@ -0,0 +1,241 @@
+package sequitur
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"sort"
+)
+
+// Passage is a passage of text found in two documents.
+type Passage struct {
+	Offset  int // the offset of the passage in the first document
+	Offset2 int // the offset of the passage in the second document
+	Length  int // the length of the passage in bytes
+}
+
+// ReusePair lists the passages reused between two documents.
+type ReusePair struct {
+	Doc, Doc2 int       // the indexes of the documents in the ReuseReport
+	Passages  []Passage // ordered by Offset, then Offset2
+	Reused    float64   // the proportion of the first document which is in a passage
+	Reused2   float64   // the proportion of the second document which is in a passage
+}
+
+// ReuseReport lists the passages reused between every pair of a set of documents.
+type ReuseReport struct {
+	Names     []string
+	Docs      [][]byte
+	MinLength int
+	Pairs     []ReusePair // only pairs with reused passages, ordered by Doc, then Doc2
+}
+
+// reuseSeedDivisor sets the minimum length of the rules seeding passages, as a fraction of the minimum passage length.
+// The second occurrence of a passage is often represented by several shorter rules, so long seeds would miss it.
+const reuseSeedDivisor = 16
+
+// Reuse finds the passages of at least minLength bytes which are in both documents. The documents are parsed
+// together, separated by a barrier, so that the second document is represented by a sequence of rules which
+// each repeat part of it, or of the first document. The occurrences in the first document of those rules of at least
+// a sixteenth of minLength seed the passages, which are merged where they are adjacent or overlap in both documents,
+// then extended once while the bytes of the documents agree. Passages which are within longer passages,
+// in both documents, are dropped, so that text repeated within a document is only reported where it adds to the
+// passages which contain it.
+func Reuse(a, b []byte, minLength int) ReusePair {
+	ret := ReusePair{}
+	seedLength := minLength / reuseSeedDivisor
+	if seedLength < 2 {
+		seedLength = 2
+	}
+	sep := []byte(string(docSeparator))
+	joint := ParseWithOptions(concat(concat(a, sep), b), Options{Barriers: []rune{docSeparator}}).Compact()
+	lengths := joint.lengths()
+
+	// the rules of the root which represent the second document, and their offsets in it
+	offset2 := len(a) + len(sep)
+	var seeds []SymbolID
+	var seedOffsets []int
+	want := make(map[SymbolID]bool)
+	off := 0
+	for _, sid := range joint.Map[joint.RootID].IDs {
+		if off >= offset2 && sid.IsRule() && lengths[sid] >= seedLength {
+			seeds = append(seeds, sid)
+			seedOffsets = append(seedOffsets, off-offset2)
+			want[sid] = true
+		}
+		off += lengths[sid]
+	}
+	positions := joint.positions(want)
+
+	diagonals := make(map[int][]Passage) // Offset-Offset2 is constant for passages which can merge
+	for i, sid := range seeds {
+		for _, p := range positions[sid] {
+			if p < len(a) { // as no rule spans the barrier
+				d := p - seedOffsets[i]
+				diagonals[d] = append(diagonals[d], Passage{Offset: p, Offset2: seedOffsets[i], Length: lengths[sid]})
+			}
+		}
+	}
+
+	for _, matched := range diagonals {
+		sort.Slice(matched, func(i, j int) bool { return matched[i].Offset < matched[j].Offset })
+		end := -1 // of the last passage on the diagonal, within which the seeds are already matched
+		for s := 0; s < len(matched); {
+			current := matched[s]
+			for s++; s < len(matched) && matched[s].Offset <= current.Offset+current.Length; s++ {
+				if e := matched[s].Offset + matched[s].Length; e > current.Offset+current.Length {
+					current.Length = e - current.Offset
+				}
+			}
+			if current.Offset+current.Length <= end {
+				continue
+			}
+			p := extendPassage(a, b, current)
+			end = p.Offset + p.Length
+			ret.Passages = append(ret.Passages, p)
+		}
+	}
+	ret.Passages = longestPassages(ret.Passages, minLength)
+
+	ret.Reused = reusedProportion(ret.Passages, len(a), func(p Passage) int { return p.Offset })
+	ret.Reused2 = reusedProportion(ret.Passages, len(b), func(p Passage) int { return p.Offset2 })
+	return ret
+}
+
+// longestPassages drops the passages shorter than minLength, and those which are within longer passages in both
+// documents, giving the rest ordered by Offset, then Offset2.
+func longestPassages(passages []Passage, minLength int) []Passage {
+	sort.Slice(passages, func(i, j int) bool {
+		if passages[i].Length != passages[j].Length {
+			return passages[i].Length > passages[j].Length
+		}
+		if passages[i].Offset != passages[j].Offset {
+			return passages[i].Offset < passages[j].Offset
+		}
+		return passages[i].Offset2 < passages[j].Offset2
+	})
+	var ret []Passage
+	for _, p := range passages {
+		if p.Length < minLength {
+			break
+		}
+		within, within2 := false, false
+		for _, q := range ret {
+			within = within || (q.Offset <= p.Offset && p.Offset+p.Length <= q.Offset+q.Length)
+			within2 = within2 || (q.Offset2 <= p.Offset2 && p.Offset2+p.Length <= q.Offset2+q.Length)
+		}
+		if !within || !within2 {
+			ret = append(ret, p)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Offset == ret[j].Offset {
+			return ret[i].Offset2 < ret[j].Offset2
+		}
+		return ret[i].Offset < ret[j].Offset
+	})
+	return ret
+}
+
+// extendPassage while the bytes before and after it are the same in both documents.
+func extendPassage(a, b []byte, p Passage) Passage {
+	for p.Offset > 0 && p.Offset2 > 0 && a[p.Offset-1] == b[p.Offset2-1] {
+		p.Offset--
+		p.Offset2--
+		p.Length++
+	}
+	for p.Offset+p.Length < len(a) && p.Offset2+p.Length < len(b) && a[p.Offset+p.Length] == b[p.Offset2+p.Length] {
+		p.Length++
+	}
+	return p
+}
+
+// reusedProportion gives the proportion of a document covered by the passages.
+func reusedProportion(passages []Passage, length int, offset func(Passage) int) float64 {
+	if length == 0 {
+		return 0
+	}
+	sorted := append([]Passage{}, passages...)
+	sort.Slice(sorted, func(i, j int) bool { return offset(sorted[i]) < offset(sorted[j]) })
+	covered, end := 0, 0
+	for _, p := range sorted {
+		start, e := offset(p), offset(p)+p.Length
+		if start < end {
+			start = end
+		}
+		if e > start {
+			covered += e - start
+		}
+		if e > end {
+			end = e
+		}
+	}
+	return float64(covered) / float64(length)
+}
+
+// NewReuseReport finds the passages of at least minLength bytes reused between every pair of documents.
+// The names label the documents in the output, and default to their indexes.
+func NewReuseReport(names []string, docs [][]byte, minLength int) *ReuseReport {
+	r := &ReuseReport{
+		Names:     make([]string, len(docs)),
+		Docs:      docs,
+		MinLength: minLength,
+	}
+	for i := range docs {
+		r.Names[i] = fmt.Sprint(i)
+		if i < len(names) {
+			r.Names[i] = names[i]
+		}
+	}
+	for i := range docs {
+		for j := i + 1; j < len(docs); j++ {
+			pair := Reuse(docs[i], docs[j], minLength)
+			if len(pair.Passages) > 0 {
+				pair.Doc, pair.Doc2 = i, j
+				r.Pairs = append(r.Pairs, pair)
+			}
+		}
+	}
+	return r
+}
+
+// WriteText renders the report as plain text.
+func (r *ReuseReport) WriteText(w io.Writer) error {
+	for _, pair := range r.Pairs {
+		if _, err := fmt.Fprintf(w, "%s (%.1f%% reused) - %s (%.1f%% reused)\n",
+			r.Names[pair.Doc], 100*pair.Reused, r.Names[pair.Doc2], 100*pair.Reused2); err != nil {
+			return err
+		}
+		for _, p := range pair.Passages {
+			if _, err := fmt.Fprintf(w, "\t%d %d %d %q\n", p.Offset, p.Offset2, p.Length,
+				r.Docs[pair.Doc][p.Offset:p.Offset+p.Length]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// WriteHTML renders the report as an HTML fragment, with a table of passages for each pair of documents.
+func (r *ReuseReport) WriteHTML(w io.Writer) error {
+	for _, pair := range r.Pairs {
+		if _, err := fmt.Fprintf(w, "<h2>%s (%.1f%% reused) &ndash; %s (%.1f%% reused)</h2>\n"+
+			"<table>\n<tr><th>%s</th><th>%s</th><th>length</th><th>passage</th></tr>\n",
+			html.EscapeString(r.Names[pair.Doc]), 100*pair.Reused,
+			html.EscapeString(r.Names[pair.Doc2]), 100*pair.Reused2,
+			html.EscapeString(r.Names[pair.Doc]), html.EscapeString(r.Names[pair.Doc2])); err != nil {
+			return err
+		}
+		for _, p := range pair.Passages {
+			if _, err := fmt.Fprintf(w, "<tr><td>%d</td><td>%d</td><td>%d</td><td><pre>%s</pre></td></tr>\n",
+				p.Offset, p.Offset2, p.Length,
+				html.EscapeString(string(r.Docs[pair.Doc][p.Offset:p.Offset+p.Length]))); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintln(w, "</table>"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package sequitur
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+)
+
+func ExampleReuseReport_WriteText() {
+	essay := "My essay on grammars. " + testImportance[1590:1790] + " That is all I have to say."
+	other := "Another essay. " + testImportance[1590:1700] + " Rules are good. " + testImportance[1720:1790]
+
+	r := NewReuseReport([]string{"wikipedia", "essay", "other"},
+		[][]byte{[]byte(testImportance), []byte(essay), []byte(other)}, 40)
+	if err := r.WriteText(os.Stdout); err != nil {
+		panic(err)
+	}
+
+	// Output:
+	// wikipedia (5.1% reused) - essay (80.3% reused)
+	// 	1590 22 200 "e process continues until no repeated digram exists in the grammar.\n\nRule utility\nThis constraint ensures that all the rules are used more than once in the right sides of all the productions of the gr"
+	// wikipedia (4.6% reused) - other (85.4% reused)
+	// 	1590 15 111 "e process continues until no repeated digram exists in the grammar.\n\nRule utility\nThis constraint ensures that "
+	// 	1720 142 70 "sed more than once in the right sides of all the productions of the gr"
+	// essay (73.5% reused) - other (86.3% reused)
+	// 	20 13 113 ". e process continues until no repeated digram exists in the grammar.\n\nRule utility\nThis constraint ensures that "
+	// 	152 142 70 "sed more than once in the right sides of all the productions of the gr"
+}
+
+func TestReuse(t *testing.T) {
+	a := []byte(testImportance)
+	b := []byte("Copied: " + testImportance[1000:1300] + " and " + testImportance[2000:2100] + ".")
+	pair := Reuse(a, b, 50)
+	if len(pair.Passages) != 2 {
+		t.Fatal("found passages", pair.Passages)
+	}
+	for _, p := range pair.Passages {
+		if !bytes.Equal(a[p.Offset:p.Offset+p.Length], b[p.Offset2:p.Offset2+p.Length]) {
+			t.Error("passage differs", p)
+		}
+	}
+	if p := pair.Passages[0]; p.Offset > 1000 || p.Offset+p.Length < 1300 {
+		t.Error("first passage not maximal", p)
+	}
+	if want := float64(300+100) / float64(len(b)); pair.Reused2 < want {
+		t.Error("reused proportion", pair.Reused2, "want at least", want)
+	}
+
+	var html bytes.Buffer
+	r := NewReuseReport(nil, [][]byte{a, b}, 50)
+	if err := r.WriteHTML(&html); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(html.String(), "<h2>0 (") || !strings.Contains(html.String(), "&#39;Aa&#39;") {
+		t.Error("unexpected HTML", html.String())
+	}
+}
+
+func TestReuseRotated(t *testing.T) {
+	// random letters and spaces, in which no passage of 20 bytes is repeated, other than by the rotation
+	rnd := rand.New(rand.NewSource(1))
+	a := make([]byte, 60000)
+	for i := range a {
+		a[i] = "abcdefghijklmnopqrstuvwxyz "[rnd.Intn(27)]
+	}
+	b := append(append([]byte{}, a[25000:]...), a[:25000]...)
+	pair := Reuse(a, b, 20)
+	if len(pair.Passages) != 2 {
+		t.Fatalf("found %d passages, want 2", len(pair.Passages))
+	}
+	if want := (Passage{0, 35000, 25000}); pair.Passages[0] != want {
+		t.Errorf("first passage %v, want %v", pair.Passages[0], want)
+	}
+	if want := (Passage{25000, 0, 35000}); pair.Passages[1] != want {
+		t.Errorf("second passage %v, want %v", pair.Passages[1], want)
+	}
+	if pair.Reused != 1 || pair.Reused2 != 1 {
+		t.Error("reused proportions", pair.Reused, pair.Reused2)
+	}
+}
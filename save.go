@@ -0,0 +1,387 @@
+package sequitur
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+)
+
+// ErrSaved is returned when loading data which was not written by Grammar.Save, or has been corrupted so that it
+// does not describe a valid grammar: one whose rules use themselves, or rules which are missing, whose counts do not
+// match their uses, or which contains symbols which are neither runes, bytes nor rules. Corruption which leaves
+// a valid grammar, such as a changed terminal symbol, cannot be detected.
+var ErrSaved = errors.New("sequitur: invalid saved Grammar")
+
+const savedMagic = "sequitur\x01" // followed by the version of the format
+
+// position locates a symbol as its index within the rules listed by Save, and its index within that rule.
+type position struct{ rule, index int }
+
+// Save writes the complete state of the grammar to w, including its options, the counter used to number new rules,
+// which rules came from a dictionary, the order in which each rule's uses are linked, if they are tracked,
+// and the occurrences of digrams recorded in the digram table, or waiting to occur K times, so that the Grammar
+// given by Load builds exactly the same rules as the original when more input is appended to it.
+// Checkpoints are not saved.
+func (g *Grammar) Save(w io.Writer) error {
+	if g.base == nil {
+		return newGrammar().Save(w)
+	}
+	sw := &savedWriter{w: bufio.NewWriter(w)}
+	sw.string(savedMagic)
+	tracked := uint64(0)
+	if g.uses != nil {
+		tracked = 1
+	}
+	sw.uvarint(g.ruleID, uint64(g.length), uint64(g.appended), uint64(g.window), uint64(g.k), tracked)
+	barriers := make([]uint64, 0, len(g.barriers))
+	for b := range g.barriers {
+		barriers = append(barriers, b)
+	}
+	sort.Slice(barriers, func(i, j int) bool { return barriers[i] < barriers[j] })
+	sw.uvarint(uint64(len(barriers)))
+	sw.uvarint(barriers...)
+
+	// the rules, in the order they are reached from the root, and the position of each of their symbols
+	list := []*rules{g.base}
+	index := map[*rules]int{g.base: 0}
+	positions := make(map[*symbols]position)
+	for i := 0; i < len(list); i++ {
+		k := 0
+		for p := list[i].first(); !p.isGuard(); p = p.next {
+			positions[p] = position{i, k}
+			k++
+			if _, seen := index[p.rule]; p.isNonTerminal() && !seen {
+				index[p.rule] = len(list)
+				list = append(list, p.rule)
+			}
+		}
+	}
+	sw.uvarint(uint64(len(list)))
+	for _, r := range list {
+		dictionary := uint64(0)
+		if r.dictionary {
+			dictionary = 1
+		}
+		sw.uvarint(r.id, uint64(r.count), dictionary)
+		var body []uint64
+		for p := r.first(); !p.isGuard(); p = p.next {
+			body = append(body, p.value)
+		}
+		sw.uvarint(uint64(len(body)))
+		sw.uvarint(body...)
+		var uses []*symbols
+		if g.uses != nil {
+			for u := r.uses; u != nil; u = g.uses.next(u) {
+				uses = append(uses, u)
+			}
+		}
+		sw.positions(uses, positions)
+	}
+
+	var table []*symbols
+	for _, s := range g.table {
+		if _, found := positions[s]; found {
+			table = append(table, s)
+		}
+	}
+	sort.Slice(table, func(i, j int) bool { return positions[table[i]].less(positions[table[j]]) })
+	sw.positions(table, positions)
+
+	ds := make([]digram, 0, len(g.waiting))
+	for d := range g.waiting {
+		ds = append(ds, d)
+	}
+	sort.Slice(ds, func(i, j int) bool { return ds[i].one < ds[j].one || (ds[i].one == ds[j].one && ds[i].two < ds[j].two) })
+	sw.uvarint(uint64(len(ds)))
+	for _, d := range ds {
+		sw.uvarint(d.one, d.two)
+		sw.positions(g.waiting[d], positions) // occurrences no longer in use are never current, so are left out
+	}
+	if sw.err != nil {
+		return sw.err
+	}
+	return sw.w.Flush()
+}
+
+// Load reads a Grammar written by Grammar.Save.
+func Load(r io.Reader) (*Grammar, error) {
+	sr := &savedReader{r: bufio.NewReader(r)}
+	magic := make([]byte, len(savedMagic))
+	if _, err := io.ReadFull(sr.r, magic); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if string(magic) != savedMagic {
+		return nil, ErrSaved
+	}
+
+	g := &Grammar{table: make(digrams)}
+	g.ruleID = sr.uvarint()
+	g.length, g.appended, g.window, g.k = sr.int(), sr.int(), sr.int(), sr.int()
+	if g.k > 2 {
+		g.waiting = make(waiting)
+	}
+	switch sr.uvarint() {
+	case 0:
+	case 1:
+		g.uses = make(uses)
+	default:
+		sr.fail()
+	}
+	if n := sr.int(); n > 0 {
+		g.barriers = make(map[uint64]bool)
+		for i := 0; i < n && sr.err == nil; i++ {
+			g.barriers[sr.uvarint()] = true
+		}
+	}
+
+	// create the rules before their bodies, which may refer to rules later in the list
+	var list []*rules
+	var bodies [][]uint64
+	var counts []int
+	var uses [][]position
+	byID := make(map[uint64]*rules)
+	for i, n := 0, sr.int(); i < n && sr.err == nil; i++ {
+		r := &rules{id: sr.uvarint()}
+		r.guard = g.newGuard(r)
+		counts = append(counts, sr.int())
+		switch sr.uvarint() {
+		case 0:
+		case 1:
+			r.dictionary = true
+		default:
+			sr.fail()
+		}
+		var body []uint64
+		for k, n := 0, sr.int(); k < n && sr.err == nil; k++ {
+			body = append(body, sr.uvarint())
+		}
+		bodies = append(bodies, body)
+		uses = append(uses, sr.positions())
+		if _, dup := byID[r.id]; dup || r.id <= maxRuneOrByte {
+			sr.fail()
+		}
+		byID[r.id] = r
+		list = append(list, r)
+	}
+	if sr.err != nil {
+		return nil, sr.err
+	}
+	if len(list) == 0 || !validSaved(g, list, counts, bodies, uses) {
+		return nil, ErrSaved
+	}
+	g.base = list[0]
+	symbolsAt := make([][]*symbols, len(list))
+	for i, r := range list {
+		for _, v := range bodies[i] {
+			s := g.newSymbolFromValue(v)
+			if v > maxRuneOrByte {
+				if s.rule = byID[v]; s.rule == nil {
+					return nil, ErrSaved
+				}
+			}
+			r.last().insertAfter(s)
+			symbolsAt[i] = append(symbolsAt[i], s)
+		}
+	}
+	at := func(p position) *symbols {
+		if p.rule >= len(symbolsAt) || p.index >= len(symbolsAt[p.rule]) {
+			sr.fail()
+			return nil
+		}
+		return symbolsAt[p.rule][p.index]
+	}
+	for i, r := range list {
+		r.count = counts[i]
+		for k := len(uses[i]) - 1; k >= 0; k-- { // each linked before the next
+			u := at(uses[i][k])
+			if _, linked := g.uses[u]; u == nil || u.rule != r || linked {
+				return nil, ErrSaved // not a use of the rule, or listed twice
+			}
+			g.uses.link(u)
+		}
+	}
+
+	for _, p := range sr.positions() {
+		if s := at(p); s != nil {
+			if s.next.isGuard() {
+				return nil, ErrSaved
+			}
+			g.table[digram{s.value, s.next.value}] = s
+		}
+	}
+	for i, n := 0, sr.int(); i < n && sr.err == nil; i++ {
+		d := digram{sr.uvarint(), sr.uvarint()}
+		for _, p := range sr.positions() {
+			if s := at(p); s != nil && g.waiting != nil {
+				g.waiting[d] = append(g.waiting[d], s)
+			}
+		}
+	}
+	if sr.err != nil {
+		return nil, sr.err
+	}
+	return g, nil
+}
+
+// validSaved checks the rules read by Load before the Grammar is built from them: that the terminal symbols are
+// runes or bytes, that the rules are reachable from the root and only use rules in the list, without using themselves,
+// that every rule but the root has at least two symbols, and that the counts of the rules, the length
+// and the counter used to number new rules match the rules.
+func validSaved(g *Grammar, list []*rules, counts []int, bodies [][]uint64, uses [][]position) bool {
+	index := make(map[uint64]int, len(list))
+	for i, r := range list {
+		if r.id > g.ruleID {
+			return false
+		}
+		index[r.id] = i
+	}
+	refs := make([]int, len(list))
+	for i, body := range bodies {
+		if i > 0 && len(body) < 2 {
+			return false
+		}
+		for _, v := range body {
+			if v > maxRuneOrByte {
+				j, found := index[v]
+				if !found || j == 0 {
+					return false
+				}
+				refs[j]++
+			} else if v < 128 { // not a runeOrByte
+				return false
+			}
+		}
+	}
+	for i := range list {
+		linked := refs[i]
+		if g.uses == nil {
+			linked = 0
+		}
+		if counts[i] != refs[i] || len(uses[i]) != linked || (i > 0 && refs[i] == 0) {
+			return false
+		}
+	}
+
+	// the length of the expansion of each rule, or -1 while it is being computed
+	lengths := make([]int, len(list))
+	done := make([]bool, len(list))
+	var length func(i int) bool
+	length = func(i int) bool {
+		if done[i] {
+			return lengths[i] >= 0
+		}
+		done[i], lengths[i] = true, -1
+		n := 0
+		for _, v := range bodies[i] {
+			if v <= maxRuneOrByte {
+				n++
+			} else if j := index[v]; !length(j) {
+				return false
+			} else {
+				n += lengths[j]
+			}
+		}
+		if n > 1<<40 {
+			return false
+		}
+		lengths[i] = n
+		return true
+	}
+	for i := range list {
+		if !length(i) { // a rule which uses itself, which may not be reachable from the root
+			return false
+		}
+	}
+	return lengths[0] == g.length && g.appended >= g.length
+}
+
+func (p position) less(q position) bool {
+	return p.rule < q.rule || (p.rule == q.rule && p.index < q.index)
+}
+
+// savedWriter writes the parts of a saved Grammar, keeping the first error.
+type savedWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (sw *savedWriter) string(s string) {
+	if sw.err == nil {
+		_, sw.err = sw.w.WriteString(s)
+	}
+}
+
+func (sw *savedWriter) uvarint(vs ...uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	for _, v := range vs {
+		if sw.err == nil {
+			_, sw.err = sw.w.Write(buf[:binary.PutUvarint(buf[:], v)])
+		}
+	}
+}
+
+// positions writes the number of symbols, then their positions.
+func (sw *savedWriter) positions(ss []*symbols, positions map[*symbols]position) {
+	var found []position
+	for _, s := range ss {
+		if p, ok := positions[s]; ok {
+			found = append(found, p)
+		}
+	}
+	sw.uvarint(uint64(len(found)))
+	for _, p := range found {
+		sw.uvarint(uint64(p.rule), uint64(p.index))
+	}
+}
+
+// savedReader reads the parts of a saved Grammar, keeping the first error, after which it reads zeros.
+type savedReader struct {
+	r   *bufio.Reader
+	err error
+}
+
+func (sr *savedReader) uvarint() uint64 {
+	if sr.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(sr.r)
+	if err != nil {
+		sr.err = unexpectedEOF(err)
+	}
+	return v
+}
+
+// int reads a count or length, which must be small enough to be one.
+func (sr *savedReader) int() int {
+	v := sr.uvarint()
+	if v > 1<<40 {
+		sr.fail()
+		return 0
+	}
+	return int(v)
+}
+
+func (sr *savedReader) positions() []position {
+	n := sr.int()
+	var ret []position
+	for i := 0; i < n && sr.err == nil; i++ {
+		ret = append(ret, position{sr.int(), sr.int()})
+	}
+	return ret
+}
+
+func (sr *savedReader) fail() {
+	if sr.err == nil {
+		sr.err = ErrSaved
+	}
+}
+
+// unexpectedEOF reports data which ends part way through a saved Grammar as io.ErrUnexpectedEOF.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
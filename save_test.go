@@ -0,0 +1,193 @@
+package sequitur
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+)
+
+func ExampleGrammar_Save() {
+
+	g := Parse([]byte("Round and round the ragged rocks, "))
+
+	var saved bytes.Buffer
+	if err := g.Save(&saved); err != nil {
+		panic(err)
+	}
+	g2, err := Load(&saved)
+	if err != nil {
+		panic(err)
+	}
+	g.Append([]byte("the ragged rascal ran."))
+	g2.Append([]byte("the ragged rascal ran."))
+
+	fmt.Println(g.Compact().String() == g2.Compact().String())
+
+	// Output:
+	// true
+}
+
+func TestSave(t *testing.T) {
+	save := func(g *Grammar) []byte {
+		var b bytes.Buffer
+		if err := g.Save(&b); err != nil {
+			t.Fatal(err)
+		}
+		return b.Bytes()
+	}
+	state := func(g *Grammar) string {
+		var b bytes.Buffer
+		if err := g.PrettyPrint(&b); err != nil {
+			t.Fatal(err)
+		}
+		return fmt.Sprint(b.String(), g.Compact(), g.Len(), g.ruleID)
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 300; i++ {
+		in := randomInput(rnd, i, 1000, "abc\n")
+		opts := Options{}
+		if i%3 == 0 {
+			opts.Barriers = []rune{'\n'}
+		}
+		if i%5 == 0 {
+			opts.Window = rnd.Intn(100)
+		}
+		if i%4 == 0 {
+			opts.K = 3 + i%3
+		}
+		g := NewGrammar(opts)
+		var loaded *Grammar
+		for len(in) > 0 {
+			n := rnd.Intn(len(in) + 1)
+			g.Append(in[:n])
+			if loaded != nil {
+				loaded.Append(in[:n])
+				if got, want := state(loaded), state(g); got != want {
+					t.Fatalf("%d: loaded grammar gave\n%s\nwant\n%s", i, got, want)
+				}
+			}
+			in = in[n:]
+
+			saved := save(g)
+			var err error
+			if loaded, err = Load(bytes.NewReader(saved)); err != nil {
+				t.Fatalf("%d: %v", i, err)
+			}
+			if err := checkInvariants(loaded); err != nil {
+				t.Fatalf("%d: %v", i, err)
+			}
+			if resaved := save(loaded); !bytes.Equal(resaved, saved) {
+				t.Fatalf("%d: saving a loaded grammar gave different data", i)
+			}
+		}
+	}
+
+	g := ParseWithDictionary([]byte(testCompact), Parse([]byte(testSimilarity)).Compact())
+	loaded, err := Load(bytes.NewReader(save(g)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.Append([]byte(testString))
+	loaded.Append([]byte(testString))
+	if got, want := state(loaded), state(g); got != want {
+		t.Fatalf("loaded grammar with a dictionary gave\n%s\nwant\n%s", got, want)
+	}
+
+	saved := save(Parse([]byte(testString)))
+	for n := 0; n < len(saved); n++ {
+		if _, err := Load(bytes.NewReader(saved[:n])); err != io.ErrUnexpectedEOF && err != ErrSaved {
+			t.Errorf("%d bytes gave %v", n, err)
+		}
+	}
+	for i := 0; i < 1000; i++ {
+		corrupt := append([]byte{}, saved...)
+		corrupt[rnd.Intn(len(corrupt))] ^= byte(1 + rnd.Intn(255))
+		if g, err := Load(bytes.NewReader(corrupt)); err == nil { // which may not detect the corruption
+			if err := g.Print(ioutil.Discard); err != nil { // but must give a grammar which can be used
+				t.Fatal(err)
+			}
+		}
+	}
+	if _, err := Load(bytes.NewReader([]byte("not a grammar"))); err != ErrSaved {
+		t.Errorf("got %v, want ErrSaved", err)
+	}
+	if g, err := Load(bytes.NewReader(save(&Grammar{}))); err != nil || g.Len() != 0 {
+		t.Errorf("zero Grammar gave %v", err)
+	}
+}
+
+// savedRule is a rule of a saved Grammar made by hand.
+type savedRule struct {
+	id, count uint64
+	body      []uint64
+	uses      []position
+}
+
+// savedData writes a saved Grammar by hand, with no digrams in the table.
+func savedData(ruleID, length uint64, rs ...savedRule) []byte {
+	var b bytes.Buffer
+	sw := &savedWriter{w: bufio.NewWriter(&b)}
+	sw.string(savedMagic)
+	sw.uvarint(ruleID, length, length, 0, 0, 1, 0, uint64(len(rs)))
+	for _, r := range rs {
+		sw.uvarint(r.id, r.count, 0, uint64(len(r.body)))
+		sw.uvarint(r.body...)
+		sw.uvarint(uint64(len(r.uses)))
+		for _, p := range r.uses {
+			sw.uvarint(uint64(p.rule), uint64(p.index))
+		}
+	}
+	sw.uvarint(0, 0)
+	if err := sw.w.Flush(); err != nil {
+		panic(err)
+	}
+	return b.Bytes()
+}
+
+func TestLoadInvalid(t *testing.T) {
+	const root, r1, a, b = rootRuleID, rootRuleID + 1, 'a' + 256, 'b' + 256
+	valid := savedData(r1, 4,
+		savedRule{root, 0, []uint64{r1, r1}, nil},
+		savedRule{r1, 2, []uint64{a, b}, []position{{0, 1}, {0, 0}}})
+	g, err := Load(bytes.NewReader(valid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := g.Print(&out); err != nil || out.String() != "abab" {
+		t.Fatalf("got %q, %v", out.Bytes(), err)
+	}
+
+	for name, data := range map[string][]byte{
+		"cycle": savedData(r1, 4,
+			savedRule{root, 0, []uint64{r1, r1}, nil},
+			savedRule{r1, 3, []uint64{r1, a}, []position{{1, 0}, {0, 1}, {0, 0}}}),
+		"count": savedData(r1, 4,
+			savedRule{root, 0, []uint64{r1, r1}, nil},
+			savedRule{r1, 1, []uint64{a, b}, []position{{0, 0}}}),
+		"uses": savedData(r1, 4,
+			savedRule{root, 0, []uint64{r1, r1}, nil},
+			savedRule{r1, 2, []uint64{a, b}, []position{{0, 0}, {0, 0}}}),
+		"empty": savedData(r1, 0,
+			savedRule{root, 0, []uint64{r1, r1}, nil},
+			savedRule{r1, 2, nil, []position{{0, 1}, {0, 0}}}),
+		"ruleID": savedData(root, 4,
+			savedRule{root, 0, []uint64{r1, r1}, nil},
+			savedRule{r1, 2, []uint64{a, b}, []position{{0, 1}, {0, 0}}}),
+		"terminal": savedData(r1, 4,
+			savedRule{root, 0, []uint64{r1, r1}, nil},
+			savedRule{r1, 2, []uint64{'a', b}, []position{{0, 1}, {0, 0}}}),
+		"length": savedData(r1, 5,
+			savedRule{root, 0, []uint64{r1, r1}, nil},
+			savedRule{r1, 2, []uint64{a, b}, []position{{0, 1}, {0, 0}}}),
+	} {
+		if _, err := Load(bytes.NewReader(data)); err != ErrSaved {
+			t.Errorf("%s: got %v, want ErrSaved", name, err)
+		}
+	}
+}
@@ -13,11 +13,22 @@ import (
 	"unicode/utf8"
 )
 
-// Grammar is a constructed grammar.  The zero value is safe to call Parse on.
+// Grammar is a constructed grammar.  The zero value is safe to call Parse or Append on.
 type Grammar struct {
-	table  digrams
-	base   *rules
-	ruleID uint64
+	table    digrams
+	base     *rules
+	ruleID   uint64
+	barriers map[uint64]bool
+	window   int        // the maximum length, or 0 if unlimited
+	length   int        // the number of terminal symbols in the expansion of base
+	appended int        // the number of terminal symbols appended, less those removed by Truncate
+	pending  []*symbols // digrams to check once the current change is complete
+	k        int        // the number of occurrences of a digram which form a rule, if more than 2
+	waiting  waiting    // the occurrences of digrams which have not yet occurred k times, other than those in table
+	uses     uses       // the links between the uses of each rule, or nil if they are not tracked
+
+	generation  int          // the number of times the grammar has been truncated
+	truncations []truncation // the shortest truncations, with no longer truncation after a shorter one
 }
 
 func (g *Grammar) nextID() uint64 {
@@ -26,9 +37,11 @@ func (g *Grammar) nextID() uint64 {
 }
 
 type rules struct {
-	id    uint64
-	guard *symbols
-	count int
+	id         uint64
+	guard      *symbols
+	count      int
+	uses       *symbols // the latest symbol referring to this rule, if uses are tracked
+	dictionary bool     // taken from the dictionary given to ParseWithDictionary, so kept while used at all
 }
 
 func (r *rules) first() *symbols { return r.guard.next }
@@ -49,11 +62,15 @@ func (g *Grammar) newSymbolFromValue(sym uint64) *symbols {
 
 func (g *Grammar) newSymbolFromRule(r *rules) *symbols {
 	r.count++
-	return &symbols{
+	s := &symbols{
 		g:     g,
 		value: r.id,
 		rule:  r,
 	}
+	if g.uses != nil {
+		g.uses.link(s)
+	}
+	return s
 }
 
 func (g *Grammar) newGuard(r *rules) *symbols {
@@ -78,15 +95,95 @@ type symbols struct {
 
 func (s *symbols) isGuard() (b bool)   { return s.isNonTerminal() && s.rule.first().prev == s }
 func (s *symbols) isNonTerminal() bool { return s.rule != nil }
+func (s *symbols) isBarrier() bool     { return !s.isNonTerminal() && s.g.barriers[s.value] }
+
+// spansBarrier says if the digram starting at s includes a barrier, so may not be part of a rule.
+func (s *symbols) spansBarrier() bool {
+	return len(s.g.barriers) > 0 && (s.isBarrier() || s.next.isBarrier())
+}
 
 func (s *symbols) delete() {
 	s.prev.join(s.next)
 	s.deleteDigram()
 	if s.isNonTerminal() {
 		s.rule.count--
+		s.unuse()
+	}
+}
+
+// unuse removes a non-terminal symbol from the uses of its rule, if they are tracked.
+func (s *symbols) unuse() {
+	if s.g.uses != nil {
+		s.g.uses.unlink(s)
 	}
 }
 
+// uses links the symbols referring to each rule, from the latest, rules.uses, so that the remaining use of a rule
+// can be found when its count falls to one, as it may when symbols are dropped, or K > 2. Only a rule given by
+// a digram falls to one use while symbols are only appended, and the symbol using it is then known,
+// so the uses are only tracked once they are needed, keeping plain parsing as fast and small as before.
+type uses map[*symbols]useLinks
+
+type useLinks struct{ next, prev *symbols }
+
+// trackUses links the uses of every rule, from now on.
+func (g *Grammar) trackUses() {
+	if g.uses != nil || g.base == nil {
+		return
+	}
+	g.uses = make(uses)
+	seen := map[*rules]bool{g.base: true}
+	for queue := []*rules{g.base}; len(queue) > 0; queue = queue[1:] {
+		for p := queue[0].first(); !p.isGuard(); p = p.next {
+			if p.isNonTerminal() {
+				g.uses.link(p)
+				if !seen[p.rule] {
+					seen[p.rule] = true
+					queue = append(queue, p.rule)
+				}
+			}
+		}
+	}
+}
+
+// link s as the latest use of its rule.
+func (u uses) link(s *symbols) {
+	r := s.rule
+	if r.uses != nil {
+		l := u[r.uses]
+		l.prev = s
+		u[r.uses] = l
+	}
+	u[s] = useLinks{next: r.uses}
+	r.uses = s
+}
+
+func (u uses) unlink(s *symbols) {
+	l, linked := u[s]
+	if !linked {
+		return
+	}
+	if l.prev != nil {
+		p := u[l.prev]
+		p.next = l.next
+		u[l.prev] = p
+	} else {
+		s.rule.uses = l.next
+	}
+	if l.next != nil {
+		n := u[l.next]
+		n.prev = l.prev
+		u[l.next] = n
+	}
+	delete(u, s)
+}
+
+// next gives the use of the same rule linked after s.
+func (u uses) next(s *symbols) *symbols { return u[s].next }
+
+// inUse says if the symbol is still part of a rule, rather than having been deleted or expanded.
+func (s *symbols) inUse() bool { return s.prev != nil && s.prev.next == s }
+
 func (s *symbols) isTriple() bool {
 	return s.prev != nil && s.next != nil &&
 		s.value == s.prev.value &&
@@ -98,17 +195,43 @@ func (s *symbols) join(right *symbols) {
 		s.deleteDigram()
 
 		if right.isTriple() {
-			s.g.table.insert(right)
+			right.record()
 		}
 
 		if s.isTriple() {
-			s.g.table.insert(s.prev)
+			s.prev.record()
 		}
 	}
 	s.next = right
 	right.prev = s
 }
 
+// record the digram starting at s in the table. If the digram is recorded elsewhere, it is repeated,
+// so it is checked once the current change is complete.
+func (s *symbols) record() {
+	if x, ok := s.g.table.lookup(s); ok && x != s {
+		s.g.recheck(s)
+		return
+	}
+	s.g.table.insert(s)
+}
+
+// recheck the digram starting at s once the current change is complete.
+func (g *Grammar) recheck(s *symbols) {
+	g.pending = append(g.pending, s)
+}
+
+// checkPending checks the digrams left by recheck, which are still in use.
+func (g *Grammar) checkPending() {
+	for len(g.pending) > 0 {
+		s := g.pending[len(g.pending)-1]
+		g.pending = g.pending[:len(g.pending)-1]
+		if s.inUse() {
+			s.check()
+		}
+	}
+}
+
 func (s *symbols) insertAfter(y *symbols) {
 	y.join(s.next)
 	s.join(y)
@@ -119,38 +242,56 @@ func (s *symbols) deleteDigram() {
 		return
 	}
 	s.g.table.delete(s)
+	if s.g.waiting != nil {
+		s.g.waiting.forget(s)
+	}
 }
 
 func (s *symbols) check() bool {
-	if s.isGuard() || s.next.isGuard() {
+	if s.isGuard() || s.next.isGuard() || s.spansBarrier() {
 		return false
 	}
 
 	x, ok := s.g.table.lookup(s)
+	if !ok && s.g.k > 2 {
+		x, ok = s.g.waiting.promote(s)
+	}
 	if !ok {
 		s.g.table.insert(s)
 		return false
 	}
 
-	if x.next != s {
-		s.match(x)
+	if s.g.k > 2 && !x.isWholeRule() {
+		return s.wait(x)
 	}
 
+	if x.overlaps(s) { // as in a triple
+		return false
+	}
+
+	s.match(x)
 	return true
 }
 
+// overlaps says if the digrams starting at s and x overlap.
+func (s *symbols) overlaps(x *symbols) bool {
+	return x.next == s || x == s.next || x == s
+}
+
 func (s *symbols) expand() {
 	left := s.prev
 	right := s.next
 	f := s.rule.first()
 	l := s.rule.last()
 
-	s.g.table.delete(s)
+	s.deleteDigram()
+	s.unuse()
 
 	left.join(f)
 	l.join(right)
 
-	s.g.table.insert(l)
+	l.record()
+	s.g.recheck(left) // not recorded, as it may repeat a digram elsewhere
 }
 
 func (s *symbols) substitute(r *rules) {
@@ -169,10 +310,24 @@ func (s *symbols) substitute(r *rules) {
 func (s *symbols) match(m *symbols) {
 	var r *rules
 
-	if m.prev.isGuard() && m.next.next.isGuard() {
+	switch {
+	case m.isWholeRule():
 		r = m.prev.rule
-		s.substitute(r)
-	} else {
+		if s.isWholeRule() { // only when dropping symbols, or adding a rule from a dictionary, which can leave two rules the same
+			old := s.prev.rule
+			if old.dictionary { // kept, as it is being added to be used
+				old, r = r, old
+			}
+			s.g.replaceRule(old, r)
+			s.g.table.insert(r.first())
+		} else {
+			s.substitute(r)
+		}
+	case s.isWholeRule(): // likewise
+		r = s.prev.rule
+		m.substitute(r)
+		s.g.table.insert(r.first())
+	default:
 		r = s.g.newRules()
 
 		r.last().insertAfter(s.g.newSymbol(s))
@@ -184,9 +339,36 @@ func (s *symbols) match(m *symbols) {
 		s.g.table.insert(r.first())
 	}
 
-	if r.first().isNonTerminal() && r.first().rule.count == 1 {
-		r.first().expand()
+	r.enforceUtility()
+}
+
+// enforceUtility expands the rules used by the first and last symbols of a new or extended rule,
+// if they are no longer used elsewhere.
+func (r *rules) enforceUtility() {
+	if f := r.first(); f.isNonTerminal() && f.rule.count == 1 && !f.rule.dictionary {
+		f.expand()
+	}
+	if l := r.last(); l.isNonTerminal() && l.rule.count == 1 && !l.rule.dictionary { // only when dropping symbols, or if K > 2
+		l.expand()
+	}
+}
+
+// isWholeRule says if the digram starting at s is the entire contents of a rule other than the root.
+func (s *symbols) isWholeRule() bool {
+	return s.prev.isGuard() && s.next.next.isGuard() && s.prev.rule != s.g.base
+}
+
+// replaceRule replaces every use of old with r, which has the same contents, then removes old.
+func (g *Grammar) replaceRule(old, r *rules) {
+	for old.uses != nil {
+		u := old.uses
+		q := u.prev
+		u.delete()
+		q.insertAfter(g.newSymbolFromRule(r))
+		g.recheck(q)
+		g.recheck(q.next)
 	}
+	g.reduce(old)
 }
 
 type digram struct{ one, two uint64 }
@@ -200,6 +382,9 @@ func (t digrams) lookup(s *symbols) (*symbols, bool) {
 }
 
 func (t digrams) insert(s *symbols) {
+	if s.isGuard() || s.next.isGuard() || s.spansBarrier() {
+		return
+	}
 	d := digram{s.value, s.next.value}
 	t[d] = s
 }
@@ -310,26 +495,107 @@ func (g *Grammar) PrettyPrint(w io.Writer) error {
 
 // Parse parses the given bytes.
 func Parse(str []byte) *Grammar {
-	g := &Grammar{
-		ruleID: maxRuneOrByte + 1,
-		table:  make(digrams),
+	return ParseWithOptions(str, Options{})
+}
+
+// Options adjust how a Grammar is built.
+type Options struct {
+	// Barriers are runes which are treated as unique, never forming a digram with their neighbours,
+	// so that no rule contains or spans them. For example, '\n' keeps every rule within a line,
+	// while rules are still reused across lines.
+	Barriers []rune
+
+	// K, if greater than 2, is the number of times a digram must occur before it forms a rule, as in k-Sequitur.
+	// Fewer accidental repeats form rules, so the rules which remain are more meaningful. A rule is still only
+	// removed when it is used once, so rules used fewer than K times remain after some of their uses are
+	// absorbed by other rules.
+	K int
+
+	// Window, if greater than 0, is the number of most recent runes (or bytes, if they are not valid UTF-8)
+	// represented by the grammar. Older input is forgotten, and rules which are no longer used twice are removed,
+	// so that the size of the grammar is bounded when parsing an endless stream.
+	Window int
+}
+
+// ParseWithOptions parses the given bytes, as adjusted by the options.
+func ParseWithOptions(str []byte, opts Options) *Grammar {
+	g := NewGrammar(opts)
+	g.appendBytes(str)
+	return g
+}
+
+// NewGrammar returns an empty Grammar, as adjusted by the options, to be built incrementally by Append.
+func NewGrammar(opts Options) *Grammar {
+	g := newGrammar()
+	g.setOptions(opts)
+	return g
+}
+
+// Append parses the given bytes, adding them to the end of the grammar.
+// A rune split between two calls is treated as separate bytes.
+func (g *Grammar) Append(str []byte) {
+	if g.base == nil {
+		g.init()
 	}
-	g.base = g.newRules()
-	for off := 0; off < len(str); {
-		var rb runeOrByte
-		r, sz := utf8.DecodeRune(str[off:])
-		if sz == 1 && r == utf8.RuneError {
-			rb = newByte(str[off])
-		} else {
-			rb = newRune(r)
-		}
-		g.base.last().insertAfter(g.newSymbolFromValue(uint64(rb)))
-		if off > 0 {
-			g.base.last().prev.check()
+	g.appendBytes(str)
+}
+
+// Len gives the number of runes (or bytes, if they are not valid UTF-8) represented by the grammar.
+func (g *Grammar) Len() int {
+	return g.length
+}
+
+func newGrammar() *Grammar {
+	g := &Grammar{}
+	g.init()
+	return g
+}
+
+func (g *Grammar) init() {
+	g.ruleID = rootRuleID - 1
+	g.table = make(digrams)
+	g.base = g.newRules() // numbered rootRuleID
+}
+
+func (g *Grammar) setOptions(opts Options) {
+	g.window = opts.Window
+	if opts.K > 2 {
+		g.k = opts.K
+		g.waiting = make(waiting)
+	}
+	if g.window > 0 || g.k > 2 {
+		g.trackUses()
+	}
+	if len(opts.Barriers) > 0 {
+		g.barriers = make(map[uint64]bool, len(opts.Barriers))
+		for _, r := range opts.Barriers {
+			g.barriers[uint64(newRune(r))] = true
 		}
-		off += sz
 	}
-	return g
+}
+
+// appendBytes adds the runes (or bytes, if they are not valid UTF-8) of str to the end of the grammar.
+func (g *Grammar) appendBytes(str []byte) {
+	eachRuneOrByte(str, func(rb runeOrByte) {
+		g.appendValue(uint64(rb))
+	})
+}
+
+// appendValue adds a terminal symbol to the end of the grammar.
+func (g *Grammar) appendValue(value uint64) {
+	g.appendSymbol(g.newSymbolFromValue(value))
+	g.length++
+	g.appended++
+	for g.window > 0 && g.length > g.window {
+		g.dropFront()
+	}
+}
+
+// appendSymbol adds a symbol to the end of the root rule, checking the digram it completes.
+func (g *Grammar) appendSymbol(s *symbols) {
+	g.base.last().insertAfter(s)
+	g.base.last().prev.check()
+	g.checkPending()
 }
 
 // runeOrByte holds a rune or a byte so that we can distinguish between
@@ -341,6 +607,23 @@ type runeOrByte rune
 
 const maxRuneOrByte = uint64(utf8.MaxRune) + 256 // larger than the largest possible value of runeOrByte
 
+// rootRuleID is the ID of the root rule of a grammar given by Parse, the first rule it numbers, which the other
+// Inferrers, and Canonicalize, also give the root so that grammars built in different ways are numbered alike.
+const rootRuleID = maxRuneOrByte + 2
+
+// eachRuneOrByte calls fn with each of the runes (or bytes, if they are not valid UTF-8) of str.
+func eachRuneOrByte(str []byte, fn func(runeOrByte)) {
+	for off := 0; off < len(str); {
+		r, sz := utf8.DecodeRune(str[off:])
+		if sz == 1 && r == utf8.RuneError {
+			fn(newByte(str[off]))
+		} else {
+			fn(newRune(r))
+		}
+		off += sz
+	}
+}
+
 func newRune(r rune) runeOrByte {
 	return runeOrByte(r + 256)
 }
@@ -188,3 +188,35 @@ func TestGolden(t *testing.T) {
 		}
 	}
 }
+
+func TestParseWithBarriers(t *testing.T) {
+	opts := Options{Barriers: []rune{'\n', ','}}
+	check := func(in []byte) bool {
+		g := ParseWithOptions(in, opts)
+		var b bytes.Buffer
+		if err := g.Print(&b); err != nil || !bytes.Equal(b.Bytes(), in) {
+			return false
+		}
+		comp := g.Compact()
+		for sid := range comp.Map {
+			if sid != comp.RootID && bytes.ContainsAny(comp.Bytes(sid), "\n,") {
+				t.Errorf("rule %v spans a barrier: %q", sid, comp.Bytes(sid))
+				return false
+			}
+		}
+		return true
+	}
+	for _, in := range []string{testString, testImportance, "\n\n\n\n,,,,a\na\na\na\n", "ab,ab,ab\nab\nab"} {
+		if !check([]byte(in)) {
+			t.Errorf("failed for %q", in)
+		}
+	}
+	if err := quick.Check(func(in []byte) bool {
+		for i := range in {
+			in[i] = "ab,\n"[in[i]%4]
+		}
+		return check(in)
+	}, nil); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,291 @@
+package sequitur
+
+import (
+	"bytes"
+	"math"
+	"sort"
+)
+
+// SimilarityMetric compares two CompactIndexed grammars, matching their symbols by the ContentHash
+// of the []byte they represent, then comparing the []byte, as different []byte may have the same ContentHash.
+// Results are in the range 0 (nothing in common) to 1 (or nearby, equality).
+type SimilarityMetric func(ci, ci2 *CompactIndexed) float64
+
+// CoverageOverlap is the symmetric metric used by CompactIndexed.Similarity:
+// the coverage of the symbols found in both grammars, divided by the total coverage of both.
+var CoverageOverlap SimilarityMetric = coverageOverlap
+
+// Containment is the asymmetric metric giving the proportion of the coverage of ci which is also found in ci2,
+// so it answers "what fraction of ci appears in ci2". An empty ci is contained in anything.
+var Containment SimilarityMetric = containment
+
+// Jaccard is the size of the intersection divided by the size of the union of the sets of symbol strings.
+var Jaccard SimilarityMetric = jaccard
+
+// Cosine is the cosine similarity of the vectors of symbol strings,
+// each weighted by the number of times the string occurs in the original input, as any of the rules which represent it.
+var Cosine SimilarityMetric = cosine
+
+// SimilarityWith compares two CompactIndexed grammars using the given metric, or CoverageOverlap if it is nil.
+func (ci *CompactIndexed) SimilarityWith(ci2 *CompactIndexed, metric SimilarityMetric) float64 {
+	if metric == nil {
+		metric = CoverageOverlap
+	}
+	return metric(ci, ci2)
+}
+
+func coverageOverlap(ci, ci2 *CompactIndexed) float64 {
+	if ci == nil || ci2 == nil {
+		return 0
+	}
+	cumCoverage := 0.0
+	eachShared(ci, ci2, ci.hashIndex(), ci2.hashIndex(), func(sid, sid2 SymbolID) {
+		cumCoverage += ci.IDinfo[sid].Coverage + ci2.IDinfo[sid2].Coverage
+	})
+	return overlap(ci, ci2, cumCoverage)
+}
+
+// overlap gives the CoverageOverlap of two grammars from the coverage of the symbols found in both.
+func overlap(ci, ci2 *CompactIndexed, cumCoverage float64) float64 {
+	divisor := (ci.TotalCoverage + ci2.TotalCoverage)
+	if divisor == 0 {
+		return 1 // two empty grammars are equal
+	}
+	return cumCoverage / divisor
+}
+
+func containment(ci, ci2 *CompactIndexed) float64 {
+	if ci == nil || ci2 == nil {
+		return 0
+	}
+	if ci.TotalCoverage == 0 {
+		return 1 // the empty grammar is contained in anything
+	}
+	cumCoverage := 0.0
+	eachShared(ci, ci2, ci.hashIndex(), ci2.hashIndex(), func(sid, _ SymbolID) {
+		cumCoverage += ci.IDinfo[sid].Coverage
+	})
+	return cumCoverage / ci.TotalCoverage
+}
+
+func jaccard(ci, ci2 *CompactIndexed) float64 {
+	if ci == nil || ci2 == nil {
+		return 0
+	}
+	index, index2 := ci.hashIndex(), ci2.hashIndex()
+	intersection := 0
+	eachShared(ci, ci2, index, index2, func(_, _ SymbolID) {
+		intersection++
+	})
+	union := len(index) + len(index2) - intersection
+	if union == 0 {
+		return 1 // two empty grammars are equal
+	}
+	return float64(intersection) / float64(union)
+}
+
+func cosine(ci, ci2 *CompactIndexed) float64 {
+	if ci == nil || ci2 == nil {
+		return 0
+	}
+	index, index2 := ci.hashIndex(), ci2.hashIndex()
+	if len(index) == 0 && len(index2) == 0 {
+		return 1 // two empty grammars are equal
+	}
+	counts, counts2 := ci.hashCounts(), ci2.hashCounts()
+	dot, norm, norm2 := 0.0, 0.0, 0.0
+	for h, n := range counts {
+		w := float64(n)
+		norm += w * w
+		if n2, found := counts2[h]; found && sameBytes(ci, index[h], ci2, index2[h]) {
+			dot += w * float64(n2)
+		}
+	}
+	for _, n2 := range counts2 {
+		w2 := float64(n2)
+		norm2 += w2 * w2
+	}
+	if norm == 0 || norm2 == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(norm*norm2)
+}
+
+// occurrences counts the number of times each rule appears in the full expansion of the root.
+func (comp *Compact) occurrences() map[SymbolID]int {
+	occ := make(map[SymbolID]int)
+	if comp == nil || comp.RootID == EmptySymbolID {
+		return occ
+	}
+	order := comp.topologicalOrder()
+	occ[comp.RootID] = 1
+	for _, sid := range order {
+		n := occ[sid]
+		for _, child := range comp.Map[sid].IDs {
+			if child.IsRule() {
+				occ[child] += n
+			}
+		}
+	}
+	return occ
+}
+
+// hashCounts counts the occurrences in the original input of each of the keys of the index given by hashIndex,
+// summing over all of the rules which represent the same []byte. Index counts them once for all comparisons.
+func (ci *CompactIndexed) hashCounts() map[ContentHash]int {
+	if ci.counts != nil {
+		return ci.counts
+	}
+	index := ci.hashIndex()
+	occ := ci.CompactBasis.occurrences()
+	ret := make(map[ContentHash]int, len(index))
+	for sid, h := range ci.symbolHashes() {
+		if _, found := index[h]; found {
+			ret[h] += occ[sid]
+		}
+	}
+	return ret
+}
+
+// symbolHashes gives the ContentHash of every rule of the grammar, as computed by Index, or computes them
+// if ci was not made by Index.
+func (ci *CompactIndexed) symbolHashes() map[SymbolID]ContentHash {
+	if ci.hashes != nil {
+		return ci.hashes
+	}
+	return ci.CompactBasis.Hashes()
+}
+
+// hashIndex gives HashToID, or the same index built from StringToID if ci was not made by Index, so has no HashToID.
+func (ci *CompactIndexed) hashIndex() map[ContentHash]SymbolID {
+	if ci.HashToID != nil || len(ci.StringToID) == 0 {
+		return ci.HashToID
+	}
+	hashes := ci.symbolHashes()
+	ret := make(map[ContentHash]SymbolID, len(ci.StringToID))
+	for _, sid := range ci.StringToID {
+		ret[hashes[sid]] = sid
+	}
+	return ret
+}
+
+// eachShared calls fn with each symbol of ci and the symbol of ci2 which represents the same []byte, given the indexes
+// of both by hashIndex, iterating over the shorter.
+func eachShared(ci, ci2 *CompactIndexed, index, index2 map[ContentHash]SymbolID, fn func(sid, sid2 SymbolID)) {
+	if len(index2) < len(index) {
+		for h, sid2 := range index2 {
+			if sid, found := index[h]; found && sameBytes(ci, sid, ci2, sid2) {
+				fn(sid, sid2)
+			}
+		}
+		return
+	}
+	for h, sid := range index {
+		if sid2, found := index2[h]; found && sameBytes(ci, sid, ci2, sid2) {
+			fn(sid, sid2)
+		}
+	}
+}
+
+// sameBytes says if symbols with the same ContentHash represent the same []byte, as they almost always do.
+func sameBytes(ci *CompactIndexed, sid SymbolID, ci2 *CompactIndexed, sid2 SymbolID) bool {
+	return ci.expansion(sid) == ci2.expansion(sid2)
+}
+
+// expansion gives the []byte represented by a symbol as a string, kept by Index for the symbols of StringToID.
+func (ci *CompactIndexed) expansion(sid SymbolID) string {
+	if str, found := ci.expansions[sid]; found {
+		return str
+	}
+	return string(ci.CompactBasis.Bytes(sid))
+}
+
+// topologicalOrder lists the rules reachable from the root, with every rule before the rules it contains.
+func (comp *Compact) topologicalOrder() SymbolIDslice {
+	seen := make(map[SymbolID]bool)
+	post := make(SymbolIDslice, 0, len(comp.Map))
+	var visit func(sid SymbolID)
+	visit = func(sid SymbolID) {
+		seen[sid] = true
+		for _, child := range comp.Map[sid].IDs {
+			if child.IsRule() && !seen[child] {
+				visit(child)
+			}
+		}
+		post = append(post, sid)
+	}
+	visit(comp.RootID)
+	for i, j := 0, len(post)-1; i < j; i, j = i+1, j-1 {
+		post[i], post[j] = post[j], post[i]
+	}
+	return post
+}
+
+// SharedRule is a symbol found in both grammars compared by SimilarityExplain.
+type SharedRule struct {
+	Bytes      []byte   // the []byte represented by the symbol in both grammars
+	ID, ID2    SymbolID // the SymbolID in the first and second grammar
+	Coverage   float64  // the coverage contributed from the first grammar
+	Coverage2  float64  // the coverage contributed from the second grammar
+	Positions  []int    // byte offsets of the symbol in the first input, if given by ExplainPositions
+	Positions2 []int    // byte offsets of the symbol in the second input, if given by ExplainPositions
+}
+
+// SimilarityExplain gives the same score as Similarity, together with the shared symbols that contributed to it,
+// ordered by the coverage they contributed. Their positions are left out, as finding them walks both inputs:
+// ExplainPositions gives them.
+func (ci *CompactIndexed) SimilarityExplain(ci2 *CompactIndexed) (score float64, shared []SharedRule) {
+	if ci == nil || ci2 == nil {
+		return 0, nil
+	}
+	cumCoverage := 0.0
+	eachShared(ci, ci2, ci.hashIndex(), ci2.hashIndex(), func(sid, sid2 SymbolID) {
+		shared = append(shared, SharedRule{
+			Bytes:     []byte(ci.expansion(sid)),
+			ID:        sid,
+			ID2:       sid2,
+			Coverage:  ci.IDinfo[sid].Coverage,
+			Coverage2: ci2.IDinfo[sid2].Coverage,
+		})
+		cumCoverage += ci.IDinfo[sid].Coverage + ci2.IDinfo[sid2].Coverage
+	})
+	sort.Slice(shared, func(i, j int) bool {
+		si, sj := shared[i].Coverage+shared[i].Coverage2, shared[j].Coverage+shared[j].Coverage2
+		if si == sj {
+			return bytes.Compare(shared[i].Bytes, shared[j].Bytes) < 0 // arbitrary but stable order
+		}
+		return si > sj
+	})
+	return overlap(ci, ci2, cumCoverage), shared
+}
+
+// ExplainPositions sets the Positions and Positions2 of the shared symbols given by ci.SimilarityExplain(ci2),
+// walking each input once for all of them.
+func (ci *CompactIndexed) ExplainPositions(ci2 *CompactIndexed, shared []SharedRule) {
+	if ci == nil || ci2 == nil {
+		return
+	}
+	want, want2 := make(map[SymbolID]bool, len(shared)), make(map[SymbolID]bool, len(shared))
+	for _, sr := range shared {
+		want[sr.ID], want2[sr.ID2] = true, true
+	}
+	positions := ci.CompactBasis.positions(want)
+	positions2 := ci2.CompactBasis.positions(want2)
+	for i := range shared {
+		shared[i].Positions = positions[shared[i].ID]
+		shared[i].Positions2 = positions2[shared[i].ID2]
+	}
+}
+
+// SimilarityMatrix compares every pair of CompactIndexed grammars using the given metric, or CoverageOverlap if it is nil.
+// The result has [i][j] equal to cis[i].SimilarityWith(cis[j], metric).
+func SimilarityMatrix(cis []*CompactIndexed, metric SimilarityMetric) [][]float64 {
+	ret := make([][]float64, len(cis))
+	for i, ci := range cis {
+		ret[i] = make([]float64, len(cis))
+		for j, ci2 := range cis {
+			ret[i][j] = ci.SimilarityWith(ci2, metric)
+		}
+	}
+	return ret
+}
@@ -1,7 +1,11 @@
 package sequitur
 
 import (
+	"bytes"
 	"fmt"
+	"math"
+	"math/rand"
+	"testing"
 )
 
 func ExampleSimilarity() {
@@ -41,6 +45,65 @@ func ExampleSimilarity() {
 
 }
 
+func ExampleCompactIndexed_SimilarityWith() {
+
+	template := Parse([]byte(testCompact)).Compact().Index(nil)
+	document := Parse([]byte(testCompact + " " + testCompact + " Then round and round again.")).Compact().Index(nil)
+
+	metrics := []SimilarityMetric{CoverageOverlap, Containment, Jaccard, Cosine}
+	metricNames := []string{"overlap", "containment", "jaccard", "cosine"}
+
+	for m, metric := range metrics {
+		fmt.Printf("%12s %7.5f %7.5f\n", metricNames[m],
+			template.SimilarityWith(document, metric), document.SimilarityWith(template, metric))
+	}
+
+	// Output:
+	//      overlap 0.19633 0.19633
+	//  containment 0.30864 0.10246
+	//      jaccard 0.41667 0.41667
+	//       cosine 0.86436 0.86436
+}
+
+func ExampleCompactIndexed_SimilarityExplain() {
+
+	ci1 := Parse([]byte("pease porridge hot,\npease porridge cold,\npease porridge in the pot,\nnine days old.")).Compact().Index(nil)
+	ci2 := Parse([]byte("pease pudding hot,\npease pudding cold,\npease pudding in the pot,\nnine days old.")).Compact().Index(nil)
+
+	score, shared := ci1.SimilarityExplain(ci2)
+	ci1.ExplainPositions(ci2, shared)
+	fmt.Printf("%7.5f\n", score)
+	for _, sr := range shared {
+		fmt.Printf("%q %7.5f %7.5f %v %v\n", sr.Bytes, sr.Coverage, sr.Coverage2, sr.Positions, sr.Positions2)
+	}
+
+	// Output:
+	// 0.07202
+	// "old" 0.03659 0.03797 [36 78] [34 75]
+	// ",\n" 0.02439 0.02532 [18 39 66] [17 37 63]
+	// "e " 0.02439 0.02532 [4 13 24 33 45 54 61 71] [4 23 43 58 68]
+	// "in" 0.02439 0.02532 [56 69] [10 29 49 53 66]
+}
+
+func TestCosineDuplicateRules(t *testing.T) {
+	const root, r1, r2 = SymbolID(rootRuleID), SymbolID(rootRuleID + 1), SymbolID(rootRuleID + 2)
+	const a, b, x SymbolID = 'a' + 256, 'b' + 256, 'x' + 256
+	// "abxabab", with the two rules for "ab" which Sequitur may make, and with one
+	duplicated := &Compact{RootID: root, Map: map[SymbolID]CompactEntry{
+		root: {IDs: SymbolIDslice{r1, x, r2, r1}},
+		r1:   {Used: 2, IDs: SymbolIDslice{a, b}},
+		r2:   {Used: 1, IDs: SymbolIDslice{a, b}},
+	}}
+	single := &Compact{RootID: root, Map: map[SymbolID]CompactEntry{
+		root: {IDs: SymbolIDslice{r1, x, r1, r1}},
+		r1:   {Used: 3, IDs: SymbolIDslice{a, b}},
+	}}
+	// counting only the rule indexed for "ab" gave 0.98995 or 0.89443, depending on which it was
+	if got := Cosine(duplicated.Index(nil), single.Index(nil)); math.Abs(got-1) > 1e-9 {
+		t.Errorf("cosine of the same text %v, want 1", got)
+	}
+}
+
 const testSimilarity = `
 Sequitur is a method for inferring compositional hierarchies from strings. 
 It detects repetition and factors it out of the string by forming rules in a grammar. 
@@ -50,3 +113,77 @@ It is useful for recognizing lexical structure in strings, and excels at very lo
 Craig Nevill-Manning, Google
 Ian Witten, University of Waikato, New Zealand
 ` // http://www.sequitur.info/
+
+func TestSimilarityMatrix(t *testing.T) {
+	cis := []*CompactIndexed{
+		Parse([]byte(testSimilarity)).Compact().Index(nil),
+		Parse([]byte(testString)).Compact().Index(nil),
+	}
+	sim := SimilarityMatrix(cis, Containment)
+	for i := range cis {
+		for j := range cis {
+			if want := Containment(cis[i], cis[j]); math.Abs(sim[i][j]-want) > 1e-9 {
+				t.Errorf("[%d][%d] = %v, want %v", i, j, sim[i][j], want)
+			}
+		}
+	}
+}
+
+func TestSimilarityHashes(t *testing.T) {
+	ci := Parse([]byte(testSimilarity)).Compact().Index(nil)
+	ci2 := Parse([]byte(testImportance)).Compact().Index(nil)
+	metrics := []SimilarityMetric{CoverageOverlap, Containment, Jaccard, Cosine}
+	want := make([]float64, len(metrics))
+	for m, metric := range metrics {
+		want[m] = metric(ci, ci2)
+	}
+
+	// a CompactIndexed made by hand, without HashToID
+	noHashes := *ci2
+	noHashes.HashToID = nil
+	for m, metric := range metrics {
+		if got := metric(ci, &noHashes); math.Abs(got-want[m]) > 1e-9 {
+			t.Errorf("metric %d without HashToID gave %v, want %v", m, got, want[m])
+		}
+	}
+
+	// a shared symbol whose hash is given to a symbol with other []byte, as if they collided
+	_, shared := ci.SimilarityExplain(ci2)
+	if len(shared) == 0 {
+		t.Fatal("no shared symbols")
+	}
+	if shared[0].Positions != nil || shared[0].Positions2 != nil {
+		t.Error("positions found without ExplainPositions")
+	}
+	collided := *ci2
+	collided.HashToID = make(map[ContentHash]SymbolID, len(ci2.HashToID))
+	for h, sid := range ci2.HashToID {
+		collided.HashToID[h] = sid
+	}
+	for _, sid := range ci2.StringToID {
+		if sid != shared[0].ID2 && sid.IsRule() {
+			collided.HashToID[ci.Hash(shared[0].ID)] = sid
+			break
+		}
+	}
+	if _, got := ci.SimilarityExplain(&collided); len(got) != len(shared)-1 {
+		t.Errorf("%d shared symbols after a collision, want %d", len(got), len(shared)-1)
+	}
+	if got := Containment(ci, &collided); got >= want[1] {
+		t.Errorf("containment %v after a collision, want less than %v", got, want[1])
+	}
+}
+
+func BenchmarkSimilarity(b *testing.B) {
+	rnd := rand.New(rand.NewSource(1))
+	in := bytes.Repeat([]byte(testImportance+testSimilarity+testString), 60)
+	in2 := append([]byte{}, in...)
+	for i := 0; i < len(in2); i += 1 + rnd.Intn(200) {
+		in2[i] = byte('a' + rnd.Intn(26))
+	}
+	ci, ci2 := Parse(in).Compact().Index(nil), Parse(in2).Compact().Index(nil)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ci.Similarity(ci2)
+	}
+}
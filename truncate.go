@@ -0,0 +1,97 @@
+package sequitur
+
+import (
+	"errors"
+	"sort"
+)
+
+// Checkpoint marks a point in the input appended to a Grammar, to which it can be rolled back.
+type Checkpoint struct {
+	g          *Grammar
+	appended   int
+	generation int // the number of times g had been truncated
+}
+
+// truncation records the length to which a grammar was truncated, as the number of terminal symbols appended,
+// and the generation it began.
+type truncation struct{ appended, generation int }
+
+// ErrCheckpoint is returned when rolling back to a Checkpoint which is not valid for the Grammar:
+// one taken from another Grammar, one taken after a point since rolled back or truncated past, even if as much
+// input has been appended again, or one taken before input forgotten by the Window.
+var ErrCheckpoint = errors.New("sequitur: invalid checkpoint")
+
+// Checkpoint marks the current end of the input.
+func (g *Grammar) Checkpoint() Checkpoint {
+	return Checkpoint{g: g, appended: g.appended, generation: g.generation}
+}
+
+// RollbackTo removes the input appended since the Checkpoint, as Truncate does, leaving a valid grammar of the input
+// before it. That grammar may differ from the one given by parsing only that input, as the rules formed since may
+// have changed those before, and the SymbolIDs of the rules formed since are not used again.
+// Rolling back invalidates any Checkpoints taken after cp.
+func (g *Grammar) RollbackTo(cp Checkpoint) error {
+	if cp.g != g || cp.appended > g.appended || g.appended-cp.appended > g.length || g.truncatedBelow(cp) {
+		return ErrCheckpoint
+	}
+	g.Truncate(g.length - (g.appended - cp.appended))
+	return nil
+}
+
+// Truncate discards all but the first n runes (or bytes, if they are not valid UTF-8) of the grammar,
+// invalidating any Checkpoints taken after them. It begins tracking the uses of every rule, as a Window does,
+// which continues for the life of the grammar, so every later Append takes about twice as long.
+// It panics if n is negative or greater than the length of the grammar.
+func (g *Grammar) Truncate(n int) {
+	if n < 0 || n > g.length {
+		panic("sequitur: truncation out of range")
+	}
+	g.trackUses()
+	for g.length > n {
+		g.dropBack()
+	}
+	g.generation++
+	for len(g.truncations) > 0 && g.truncations[len(g.truncations)-1].appended >= g.appended {
+		g.truncations = g.truncations[:len(g.truncations)-1] // as this truncation is shorter, and later
+	}
+	g.truncations = append(g.truncations, truncation{g.appended, g.generation})
+}
+
+// truncatedBelow says if the grammar has been truncated to before the Checkpoint since it was taken. The truncations
+// are kept in order of both length and generation, so the shortest since the Checkpoint is the first after it.
+func (g *Grammar) truncatedBelow(cp Checkpoint) bool {
+	i := sort.Search(len(g.truncations), func(i int) bool { return g.truncations[i].generation > cp.generation })
+	return i < len(g.truncations) && g.truncations[i].appended < cp.appended
+}
+
+// dropBack removes the last terminal symbol from the expansion of the grammar.
+// A non-terminal symbol at the back is replaced by the contents of its rule, less the last terminal symbol,
+// and the new digrams this creates are checked, as when appending.
+func (g *Grammar) dropBack() {
+	l := g.base.last()
+	if l.isGuard() {
+		return
+	}
+	var replacement []*symbols // in place before any rule can be removed by reduce or check
+	for s := l; s.isNonTerminal(); s = s.rule.last() {
+		for p := s.rule.first(); p != s.rule.last(); p = p.next {
+			replacement = append(replacement, g.newSymbol(p))
+		}
+	}
+	l.delete()
+	for _, s := range replacement {
+		g.base.last().insertAfter(s)
+	}
+	if l.isNonTerminal() {
+		g.reduce(l.rule)
+	}
+	g.checkPending()
+	for _, s := range replacement { // as if appending them one at a time
+		if s.inUse() && s.prev.inUse() {
+			s.prev.check()
+			g.checkPending()
+		}
+	}
+	g.length--
+	g.appended--
+}
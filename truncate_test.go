@@ -0,0 +1,137 @@
+package sequitur
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"testing"
+)
+
+func ExampleGrammar_RollbackTo() {
+	g := NewGrammar(Options{})
+	g.Append([]byte("pease porridge hot,\npease porridge cold,\n"))
+	cp := g.Checkpoint()
+	g.Append([]byte("pease pudding hot,\n"))
+	if err := g.RollbackTo(cp); err != nil {
+		fmt.Println(err)
+	}
+	g.Append([]byte("pease porridge in the pot,\n"))
+	if err := g.PrettyPrint(os.Stdout); err != nil {
+		fmt.Println(err)
+	}
+
+	// Output:
+	// 0 -> 1 h o t 2 c o l d 2 i n _ t h 3 t 4
+	// 1 -> p e a s 3 r r i d g 5
+	// 2 -> 4 1
+	// 3 -> 5 p o
+	// 4 -> , \n
+	// 5 -> e _
+}
+
+func TestTruncate(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 400; i++ {
+		opts := Options{}
+		if i%2 == 0 {
+			opts.Window = 1 + rnd.Intn(60)
+		}
+		if i%3 == 0 {
+			opts.Barriers = []rune{'\n'}
+		}
+		if i%5 == 0 {
+			opts.K = 3 + i%4
+		}
+		g := NewGrammar(opts)
+		var want []byte
+		var cps []Checkpoint
+		var cpWant [][]byte
+		for step := 0; step < 100; step++ {
+			switch op := rnd.Intn(10); {
+			case op < 6:
+				in := randomInput(rnd, i, 20, "abc\n")
+				g.Append(in)
+				want = append(want, in...)
+				if opts.Window > 0 && len(want) > opts.Window {
+					want = want[len(want)-opts.Window:]
+				}
+			case op < 8:
+				cps = append(cps, g.Checkpoint())
+				cpWant = append(cpWant, append([]byte{}, want...))
+			case op < 9 && len(cps) > 0:
+				c := rnd.Intn(len(cps))
+				err := g.RollbackTo(cps[c])
+				if opts.Window == 0 && err != nil {
+					t.Fatal(err)
+				}
+				if err == nil {
+					if opts.Window == 0 {
+						want = cpWant[c]
+					} else {
+						want = want[:len(want)-(len(want)-g.Len())]
+					}
+				}
+				cps, cpWant = cps[:c], cpWant[:c]
+			default:
+				n := rnd.Intn(len(want) + 1)
+				g.Truncate(n)
+				want = want[:n]
+				cps, cpWant = nil, nil
+			}
+			if err := checkInvariants(g); err != nil {
+				t.Fatalf("%+v step %d: %v", opts, step, err)
+			}
+			var b bytes.Buffer
+			if err := g.Print(&b); err != nil || !bytes.Equal(b.Bytes(), want) || g.Len() != len(want) {
+				t.Fatalf("%+v step %d: got %q, want %q", opts, step, b.Bytes(), want)
+			}
+		}
+	}
+
+	g := NewGrammar(Options{Window: 10})
+	cp := g.Checkpoint()
+	g.Append([]byte(testImportance[:100]))
+	if err := g.RollbackTo(cp); err != ErrCheckpoint {
+		t.Error("rolled back past the window", err)
+	}
+	if err := NewGrammar(Options{}).RollbackTo(g.Checkpoint()); err != ErrCheckpoint {
+		t.Error("rolled back to another grammar", err)
+	}
+
+	// a checkpoint rolled back past is not valid, even once as much input has been appended again
+	g = NewGrammar(Options{})
+	g.Append([]byte("abcabc"))
+	cp1 := g.Checkpoint()
+	g.Append([]byte("xyz"))
+	cp2 := g.Checkpoint()
+	if err := g.RollbackTo(cp1); err != nil {
+		t.Fatal(err)
+	}
+	g.Append([]byte("123"))
+	if err := g.RollbackTo(cp2); err != ErrCheckpoint {
+		t.Error("rolled back to a stale checkpoint", err)
+	}
+	var b bytes.Buffer
+	if err := g.Print(&b); err != nil || b.String() != "abcabc123" {
+		t.Errorf("got %q, want %q", b.String(), "abcabc123")
+	}
+	if err := g.RollbackTo(cp1); err != nil {
+		t.Error("could not roll back to a checkpoint before the rollback", err)
+	}
+}
+
+func TestTruncateParse(t *testing.T) {
+	runes := []rune(testImportance)
+	g := Parse([]byte(testImportance))
+	for n := len(runes) - 1; n > 0; n -= 97 {
+		g.Truncate(n)
+		if err := checkInvariants(g); err != nil {
+			t.Fatal(n, err)
+		}
+		var b bytes.Buffer
+		if err := g.Print(&b); err != nil || b.String() != string(runes[:n]) {
+			t.Fatal("unexpected output after Truncate", n)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package sequitur
+
+// dropFront removes the first terminal symbol from the expansion of the grammar.
+// A non-terminal symbol at the front is replaced by the contents of its rule, less the first terminal symbol,
+// and the new digrams this creates are checked, as when appending, but in reverse.
+func (g *Grammar) dropFront() {
+	f := g.base.first()
+	if f.isGuard() {
+		return
+	}
+	var replacement []*symbols // in place before any rule can be removed by reduce or check
+	for s := f; s.isNonTerminal(); s = s.rule.first() {
+		var level []*symbols
+		for p := s.rule.first().next; !p.isGuard(); p = p.next {
+			level = append(level, g.newSymbol(p))
+		}
+		replacement = append(level, replacement...)
+	}
+	f.delete()
+	for i := len(replacement) - 1; i >= 0; i-- {
+		g.base.guard.insertAfter(replacement[i])
+	}
+	if f.isNonTerminal() {
+		g.reduce(f.rule)
+	}
+	g.checkPending()
+	for i := len(replacement) - 1; i >= 0; i-- { // as if prepending them one at a time
+		if replacement[i].inUse() {
+			replacement[i].check()
+			g.checkPending()
+		}
+	}
+	g.length--
+}
+
+// reduce restores rule utility after the count of a rule has been decremented,
+// expanding its remaining use if it is used once, unless it is from a dictionary,
+// or removing its contents if it is not used at all.
+func (g *Grammar) reduce(r *rules) {
+	switch r.count {
+	case 0:
+		for p := r.first(); p != r.guard; {
+			p.deleteDigram()
+			if p.isNonTerminal() {
+				p.rule.count--
+				p.unuse()
+				g.reduce(p.rule)
+			}
+			p, p.prev = p.next, nil // no longer in use
+		}
+		r.guard.next, r.guard.prev = r.guard, r.guard // an empty rule, so its guard is never checked
+	case 1:
+		if !r.dictionary {
+			r.uses.expand()
+		}
+	}
+}
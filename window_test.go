@@ -0,0 +1,80 @@
+package sequitur
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"testing"
+)
+
+func ExampleNewGrammar() {
+	g := NewGrammar(Options{Window: 16})
+	for _, line := range []string{"pease porridge hot,\n", "pease porridge cold,\n", "pease porridge in the pot,\n"} {
+		g.Append([]byte(line))
+	}
+	if err := g.PrettyPrint(os.Stdout); err != nil {
+		fmt.Println(err)
+	}
+
+	// Output:
+	// 0 -> d g 1 i n _ t h 1 p o t , \n
+	// 1 -> e _
+}
+
+func TestWindow(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 600; i++ {
+		opts := Options{Window: 1 + rnd.Intn(60)}
+		if i%3 == 0 {
+			opts.Barriers = []rune{'\n'}
+		}
+		g := NewGrammar(opts)
+		in := randomInput(rnd, i, 400, "abc\n")
+		for j := range in {
+			g.Append(in[j : j+1])
+			if err := checkInvariants(g); err != nil {
+				t.Fatalf("%+v after %q: %v", opts, in[:j+1], err)
+			}
+			want := in[:j+1]
+			if len(want) > opts.Window {
+				want = want[len(want)-opts.Window:]
+			}
+			var b bytes.Buffer
+			if err := g.Print(&b); err != nil || !bytes.Equal(b.Bytes(), want) || g.Len() != len(want) {
+				t.Fatalf("%+v after %q: got %q", opts, in[:j+1], b.Bytes())
+			}
+		}
+	}
+}
+
+func TestWindowBounded(t *testing.T) {
+	g := NewGrammar(Options{Window: 1000})
+	for i := 0; i < 10; i++ {
+		g.Append([]byte(testImportance))
+	}
+	if err := checkInvariants(g); err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	runes := []rune(testImportance)
+	if err := g.Print(&b); err != nil || b.String() != string(runes[len(runes)-1000:]) {
+		t.Error("unexpected window", b.String())
+	}
+	if n := len(g.table); n > 1000 {
+		t.Error("digram table has", n, "entries")
+	}
+}
+
+func TestAppendZeroGrammar(t *testing.T) {
+	var g Grammar
+	g.Append([]byte(testString[:60]))
+	g.Append([]byte(testString[60:]))
+	var b bytes.Buffer
+	if err := g.Print(&b); err != nil || b.String() != testString {
+		t.Error("unexpected output", b.String())
+	}
+	if err := checkInvariants(&g); err != nil {
+		t.Error(err)
+	}
+}